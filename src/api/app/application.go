@@ -1,10 +1,19 @@
 package app
 
 import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+
 	"github.com/gin-gonic/gin"
-	"github.com/jebo87/golang-microservices/src/api/log/logruslog"
-	"github.com/jebo87/golang-microservices/src/api/log/zaplog"
-	"github.com/sirupsen/logrus"
+	"github.com/jebo87/golang-microservices/src/api/clients/restclient"
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/jebo87/golang-microservices/src/api/domain/github/providers/github_provider"
+	"github.com/jebo87/golang-microservices/src/api/log"
+	"github.com/jebo87/golang-microservices/src/api/secrets"
+	"github.com/jebo87/golang-microservices/src/api/tlsconfig"
+	"github.com/jebo87/golang-microservices/src/api/tracing"
 )
 
 var (
@@ -12,16 +21,104 @@ var (
 )
 
 func init() {
-	router = gin.Default()
+	//gin's own logger is replaced by middlewares.AccessLog, and its recovery is
+	//added by mapURLs
+	router = gin.New()
 }
 
+//StartApp serves the api until it is asked to stop. It exits with 1 when the
+//api can't be started or stopped cleanly.
 func StartApp() {
-	logruslog.Info("logrus: About to map the URLs", "step:1", "status:pending")
-	zaplog.Info("zap: About to map the URLs", zaplog.Field("step", "1"), zaplog.Field("status", "pending"))
+	err := run(config.Get())
+	if err != nil {
+		log.Error("error running the app", err)
+	}
+	_ = log.Sync()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+//run sets up everything described by cfg and serves until a shutdown signal.
+func run(cfg config.Config) error {
+	if err := applyConfig(cfg); err != nil {
+		return err
+	}
+	if err := configureGithubAuth(cfg.Github); err != nil {
+		return err
+	}
+	if err := configureTransport(cfg.Github.Transport); err != nil {
+		return err
+	}
+	stopTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := stopTracing(context.Background()); err != nil {
+			log.Error("error flushing traces", err)
+		}
+	}()
+	stopWatch := watchConfig()
+	defer stopWatch()
+
+	log.Info("about to map the URLs", log.String("step", "1"), log.String("status", "pending"))
 	mapURLs()
-	logrus.Info("URLs mapped succesfully", "step:2", "status:executed")
+	log.Info("URLs mapped succesfully", log.String("step", "2"), log.String("status", "executed"))
+
+	server := newServer(cfg.Server, router)
+	if cfg.Server.TLS.Enabled() {
+		if server.TLSConfig, err = tlsconfig.New(cfg.Server.TLS); err != nil {
+			return err
+		}
+	}
+	listener, err := net.Listen("tcp", cfg.Server.Address)
+	if err != nil {
+		return err
+	}
+	log.Info("listening", log.String("address", listener.Addr().String()), log.Bool("tls", cfg.Server.TLS.Enabled()))
+	if err := serve(server, listener, cfg.Server.ShutdownTimeout.Duration, shutdownSignals()); err != nil {
+		//e.g. the requests in flight outlived server.shutdown_timeout
+		return fmt.Errorf("error stopping the server: %w", err)
+	}
+	return nil
+}
+
+//configureGithubAuth sets the token sent to github: the personal access token
+//read as told by cfg.Token, or the installation tokens of the github App.
+func configureGithubAuth(cfg config.GithubConfig) error {
+	if cfg.Auth != config.GithubAuthApp {
+		return secrets.Configure(cfg.Token)
+	}
+	auth, err := github_provider.NewAppAuth(github_provider.AppSettings{
+		AppID:          int64(cfg.App.ID),
+		InstallationID: int64(cfg.App.InstallationID),
+		PrivateKeyFile: cfg.App.PrivateKeyFile,
+		RefreshBefore:  cfg.App.RefreshBefore.Duration,
+	})
+	if err != nil {
+		return err
+	}
+	secrets.GithubToken = auth
+	return nil
+}
 
-	if err := router.Run("localhost:8080"); err != nil {
-		panic(err)
+//configureTransport replaces the restclient http client with one built from
+//cfg. It is not reloaded, changes need a restart.
+func configureTransport(cfg config.TransportConfig) error {
+	settings := restclient.DefaultTransportSettings
+	settings.DialTimeout = cfg.DialTimeout.Duration
+	settings.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout.Duration
+	settings.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	settings.IdleConnTimeout = cfg.IdleConnTimeout.Duration
+	settings.HTTP2 = cfg.HTTP2
+	settings.Proxy = cfg.Proxy
+	settings.NoProxy = cfg.NoProxy
+	settings.CAFile = cfg.CAFile
+	client, err := restclient.NewHTTPClient(settings)
+	if err != nil {
+		return err
 	}
+	restclient.Client = client
+	return nil
 }
@@ -0,0 +1,119 @@
+package app
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/clients/restclient"
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/jebo87/golang-microservices/src/api/log"
+)
+
+const (
+	configWatchInterval = 5 * time.Second
+)
+
+//applyConfig pushes the runtime settings to the packages that cache them.
+func applyConfig(cfg config.Config) error {
+	if err := log.SetLevel(cfg.Log.Level); err != nil {
+		return err
+	}
+	//the loggers were built before the configuration file and the flags were loaded
+	if err := log.SetProduction(cfg.Production()); err != nil {
+		return err
+	}
+	if err := log.SetBackend(cfg.Log.Backend); err != nil {
+		return err
+	}
+	restclient.SetTimeout(cfg.Github.Timeout.Duration)
+	restclient.SetMaxResponseBytes(int64(cfg.Github.MaxResponseBytes))
+	restclient.SetRetryPolicy(restclient.RetryPolicy{
+		MaxAttempts:    cfg.Github.Retry.MaxAttempts,
+		InitialBackoff: cfg.Github.Retry.InitialBackoff.Duration,
+		MaxBackoff:     cfg.Github.Retry.MaxBackoff.Duration,
+	})
+	restclient.SetBreakerSettings(restclient.BreakerSettings{
+		Enabled:          cfg.Github.CircuitBreaker.Enabled,
+		FailureRatio:     cfg.Github.CircuitBreaker.FailureRatio,
+		MinRequests:      cfg.Github.CircuitBreaker.MinRequests,
+		Window:           cfg.Github.CircuitBreaker.Window.Duration,
+		CoolDown:         cfg.Github.CircuitBreaker.CoolDown.Duration,
+		HalfOpenRequests: cfg.Github.CircuitBreaker.HalfOpenRequests,
+	})
+	restclient.SetRateLimitSettings(restclient.RateLimitSettings{
+		Enabled:           cfg.Github.RateLimit.Enabled,
+		RequestsPerSecond: cfg.Github.RateLimit.RequestsPerSecond,
+		Burst:             cfg.Github.RateLimit.Burst,
+		Wait:              cfg.Github.RateLimit.OnExhausted == config.RateLimitWait,
+		MaxWait:           cfg.Github.RateLimit.MaxWait.Duration,
+	})
+	restclient.SetCacheSettings(restclient.CacheSettings{
+		Enabled:      cfg.Github.Cache.Enabled,
+		MaxBodyBytes: cfg.Github.Cache.MaxBodyBytes,
+	})
+	if store, ok := restclient.GetCacheStore().(*restclient.LRUCache); ok {
+		store.Resize(cfg.Github.Cache.MaxEntries)
+	}
+	restclient.SetFaults(faults(cfg.Faults))
+	return nil
+}
+
+//faults returns the faults to inject, none unless enabled. Validate refuses
+//to enable them in production.
+func faults(cfg config.FaultsConfig) []restclient.Fault {
+	if !cfg.Enabled {
+		return nil
+	}
+	result := make([]restclient.Fault, 0, len(cfg.Faults))
+	for _, fault := range cfg.Faults {
+		result = append(result, restclient.Fault{
+			Host:       fault.Host,
+			PathPrefix: fault.Path,
+			Percent:    fault.Percent,
+			Delay:      fault.Delay.Duration,
+			Status:     fault.Status,
+			Error:      fault.Error,
+		})
+	}
+	return result
+}
+
+func onConfigChange(previous config.Config, current config.Config, changes []config.Change) {
+	for _, change := range changes {
+		log.Info("configuration changed",
+			log.String("key", change.Key),
+			log.String("previous", change.Previous),
+			log.String("current", change.Current))
+	}
+	if err := applyConfig(current); err != nil {
+		log.Error("error applying configuration", err)
+	}
+}
+
+//watchConfig reloads the configuration when the config file changes or on SIGHUP.
+//Calling the returned function stops watching.
+func watchConfig() (stop func()) {
+	config.OnChange(onConfigChange)
+	stopWatch := config.Watch(configWatchInterval, func(err error) {
+		log.Error("error reloading configuration", err)
+	})
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			log.Info("SIGHUP received, reloading configuration")
+			if _, err := config.Reload(); err != nil {
+				log.Error("error reloading configuration", err)
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(hangup)
+		close(hangup)
+		stopWatch()
+	}
+}
@@ -0,0 +1,44 @@
+package app
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/jebo87/golang-microservices/src/api/log"
+	"github.com/jebo87/golang-microservices/src/api/log/logruslog"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvironmentFromTheFileSetsTheLogFormat(t *testing.T) {
+	previous := config.Get()
+	defer func() {
+		config.Set(previous)
+		assert.Nil(t, applyConfig(previous))
+	}()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("environment: production\nlog:\n  backend: zap\n"), 0600))
+	assert.Nil(t, config.Load([]string{"-config", path}))
+
+	//zap writes to the stdout of when it is built
+	stdout := os.Stdout
+	reader, writer, err := os.Pipe()
+	assert.Nil(t, err)
+	os.Stdout = writer
+	err = applyConfig(config.Get())
+	os.Stdout = stdout
+	assert.Nil(t, err)
+
+	log.Info("in production")
+	_ = log.Sync()
+	writer.Close()
+	output, _ := ioutil.ReadAll(reader)
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal(output, &entry), string(output))
+	assert.EqualValues(t, "in production", entry["msg"])
+	assert.IsType(t, &logrus.JSONFormatter{}, logruslog.Log.Formatter)
+}
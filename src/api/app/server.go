@@ -0,0 +1,64 @@
+package app
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/jebo87/golang-microservices/src/api/log"
+)
+
+//newServer builds the http server of the api from the configuration.
+func newServer(cfg config.ServerConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Address,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout.Duration,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout.Duration,
+		WriteTimeout:      cfg.WriteTimeout.Duration,
+		IdleTimeout:       cfg.IdleTimeout.Duration,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+//shutdownSignals returns a channel receiving SIGTERM and SIGINT.
+func shutdownSignals() <-chan os.Signal {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	return stop
+}
+
+//serve accepts connections on listener until a signal arrives on stop. Then it
+//stops accepting new connections and waits up to shutdownTimeout for the
+//in-flight requests, including the goroutines of a CreateRepos batch, to finish.
+func serve(server *http.Server, listener net.Listener, shutdownTimeout time.Duration, stop <-chan os.Signal) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			//certificates come from server.TLSConfig
+			serveErr <- server.ServeTLS(listener, "", "")
+			return
+		}
+		serveErr <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case sig := <-stop:
+		log.Info("shutting down the server", log.String("signal", sig.String()), log.Duration("timeout", shutdownTimeout))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		return err
+	}
+	log.Info("server stopped, all requests drained")
+	return nil
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewServer(t *testing.T) {
+	cfg := config.Default().Server
+	server := newServer(cfg, http.NotFoundHandler())
+
+	assert.EqualValues(t, "localhost:8080", server.Addr)
+	assert.EqualValues(t, 30*time.Second, server.ReadTimeout)
+	assert.EqualValues(t, 10*time.Second, server.ReadHeaderTimeout)
+	assert.EqualValues(t, 2*time.Minute, server.WriteTimeout)
+	assert.EqualValues(t, 2*time.Minute, server.IdleTimeout)
+	assert.EqualValues(t, 1<<20, server.MaxHeaderBytes)
+}
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := newServer(config.Default().Server, handler)
+	stop := make(chan os.Signal, 1)
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(server, listener, 5*time.Second, stop)
+	}()
+
+	responses := make(chan string, 1)
+	go func() {
+		response, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			responses <- err.Error()
+			return
+		}
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(response.Body)
+		responses <- string(body)
+	}()
+
+	<-started
+	stop <- syscall.SIGTERM
+
+	assert.EqualValues(t, "done", <-responses)
+	assert.Nil(t, <-served)
+
+	_, err = net.Dial("tcp", listener.Addr().String())
+	assert.NotNil(t, err)
+}
+
+func TestRunReturnsSetupErrors(t *testing.T) {
+	previous := config.Get()
+	defer func() { assert.Nil(t, applyConfig(previous)) }()
+	cfg := config.Default()
+	cfg.Github.Auth = config.GithubAuthApp
+	cfg.Github.App.PrivateKeyFile = "missing.pem"
+
+	err := run(cfg)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "error reading the github app private key")
+}
@@ -1,12 +1,31 @@
 package app
 
 import (
+	"github.com/gin-gonic/gin"
+	"github.com/jebo87/golang-microservices/src/api/controllers/admin"
+	"github.com/jebo87/golang-microservices/src/api/controllers/auth"
 	"github.com/jebo87/golang-microservices/src/api/controllers/polo"
 	"github.com/jebo87/golang-microservices/src/api/controllers/repositories"
+	"github.com/jebo87/golang-microservices/src/api/metrics"
+	"github.com/jebo87/golang-microservices/src/api/middlewares"
 )
 
 func mapURLs() {
+	//the recovery runs inside the access log and the metrics, so the panics
+	//are logged and counted as the 500 they are answered with
+	router.Use(middlewares.RequestID, middlewares.Tracing, middlewares.ClientIdentity, middlewares.AccessLog, middlewares.Metrics, gin.Recovery())
+
 	router.POST("/repository", repositories.CreateRepo)
 	router.POST("/repositories", repositories.CreateRepos)
 	router.GET("/marco", polo.Marco)
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+	router.GET("/auth/github/login", auth.Login)
+	router.GET("/auth/github/callback", auth.Callback)
+
+	adminGroup := router.Group("/admin", admin.Authenticate)
+	adminGroup.GET("/config", admin.GetConfig)
+	adminGroup.PATCH("/config", admin.UpdateConfig)
+	adminGroup.GET("/circuit_breakers", admin.GetCircuitBreakers)
+	adminGroup.GET("/faults", admin.GetFaults)
+	adminGroup.PUT("/faults", admin.UpdateFaults)
 }
@@ -0,0 +1,187 @@
+package restclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+)
+
+//Body is a request body sent as it is, with its content type, instead of
+//being encoded as json. Pass it as the body of Post, Put or Patch.
+type Body struct {
+	ContentType string
+	//Length is the size of the body, -1 when unknown.
+	Length int64
+
+	open func() (io.ReadCloser, error)
+	//once bodies can only be read once, their calls are not retried.
+	once bool
+}
+
+//Bytes is a body sending data.
+func Bytes(contentType string, data []byte) Body {
+	return Body{
+		ContentType: contentType,
+		Length:      int64(len(data)),
+		open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(data)), nil
+		},
+	}
+}
+
+//Reader is a body streamed from r, of length bytes or -1 when unknown. As r
+//can only be read once, the calls sending it are not retried.
+func Reader(contentType string, r io.Reader, length int64) Body {
+	return Body{
+		ContentType: contentType,
+		Length:      length,
+		open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(r), nil
+		},
+		once: true,
+	}
+}
+
+//File is a body streamed from the file at path, opened again for every attempt.
+func File(contentType string, path string) (Body, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Body{}, err
+	}
+	return Body{
+		ContentType: contentType,
+		Length:      info.Size(),
+		open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+	}, nil
+}
+
+//jsonBody encodes body as json, unless it is already a Body.
+func jsonBody(body interface{}) (*Body, error) {
+	switch b := body.(type) {
+	case nil:
+		return nil, nil
+	case Body:
+		return &b, nil
+	case *Body:
+		return b, nil
+	case *Multipart:
+		encoded := b.Body()
+		return &encoded, nil
+	}
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	result := Bytes("application/json", encoded)
+	return &result, nil
+}
+
+type part struct {
+	field    string
+	filename string
+	open     func() (io.ReadCloser, error)
+	once     bool
+}
+
+//Multipart builds a multipart/form-data body. The parts are streamed while
+//the call is sent, so large files are never held in memory.
+type Multipart struct {
+	boundary string
+	parts    []part
+}
+
+func NewMultipart() *Multipart {
+	return &Multipart{boundary: multipart.NewWriter(ioutil.Discard).Boundary()}
+}
+
+//Field adds a form field.
+func (m *Multipart) Field(name string, value string) *Multipart {
+	return m.add(part{field: name, open: func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader([]byte(value))), nil
+	}})
+}
+
+//File adds a file named filename with content data.
+func (m *Multipart) File(field string, filename string, data []byte) *Multipart {
+	return m.add(part{field: field, filename: filename, open: func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}})
+}
+
+//FileFromPath adds the file at path, opened again for every attempt.
+func (m *Multipart) FileFromPath(field string, path string) *Multipart {
+	return m.add(part{field: field, filename: filepath.Base(path), open: func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}})
+}
+
+//FileFromReader adds a file named filename read from r. As r can only be
+//read once, the calls sending the body are not retried.
+func (m *Multipart) FileFromReader(field string, filename string, r io.Reader) *Multipart {
+	return m.add(part{field: field, filename: filename, once: true, open: func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(r), nil
+	}})
+}
+
+func (m *Multipart) add(p part) *Multipart {
+	m.parts = append(m.parts, p)
+	return m
+}
+
+//Body returns the body sending the parts added so far.
+func (m *Multipart) Body() Body {
+	parts := append([]part(nil), m.parts...)
+	body := Body{
+		ContentType: "multipart/form-data; boundary=" + m.boundary,
+		Length:      -1,
+		open: func() (io.ReadCloser, error) {
+			reader, writer := io.Pipe()
+			go func() {
+				writer.CloseWithError(writeParts(writer, m.boundary, parts))
+			}()
+			return reader, nil
+		},
+	}
+	for _, p := range parts {
+		body.once = body.once || p.once
+	}
+	return body
+}
+
+//writeParts fails, ending the call, when a part can't be read or when the
+//reader of the pipe is closed because the call was given up.
+func writeParts(w io.Writer, boundary string, parts []part) error {
+	writer := multipart.NewWriter(w)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return err
+	}
+	for _, p := range parts {
+		var destination io.Writer
+		var err error
+		if p.filename == "" {
+			destination, err = writer.CreateFormField(p.field)
+		} else {
+			destination, err = writer.CreateFormFile(p.field, p.filename)
+		}
+		if err != nil {
+			return err
+		}
+		content, err := p.open()
+		if err != nil {
+			return fmt.Errorf("error reading part %s: %s", p.field, err)
+		}
+		_, err = io.Copy(destination, content)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
@@ -0,0 +1,112 @@
+package restclient
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBytesBody(t *testing.T) {
+	server := useServer(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.EqualValues(t, "application/octet-stream", r.Header.Get("Content-Type"))
+		assert.EqualValues(t, 5, r.ContentLength)
+		w.Write(body)
+	})
+
+	response, err := Post(context.Background(), server.URL, Bytes("application/octet-stream", []byte("\x00raw\x01")), nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "\x00raw\x01", readBody(t, response))
+}
+
+func TestContentTypeGivenByCaller(t *testing.T) {
+	server := useServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Content-Type")))
+	})
+
+	response, err := Put(context.Background(), server.URL, Bytes("text/plain", []byte("x")), http.Header{"Content-Type": {"text/csv"}})
+	assert.Nil(t, err)
+	assert.EqualValues(t, "text/csv", readBody(t, response))
+}
+
+func TestFileBodyIsSentOnEveryAttempt(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "asset.zip")
+	assert.Nil(t, ioutil.WriteFile(file, []byte("zip content"), 0600))
+	body, err := File("application/zip", file)
+	assert.Nil(t, err)
+	sent := useResponses(t, fastRetries, status(http.StatusBadGateway), status(http.StatusOK))
+
+	response, err := Put(context.Background(), "https://uploads.github.com/asset", body, nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, response.StatusCode)
+	assert.EqualValues(t, 2, len(*sent))
+	for _, req := range *sent {
+		content, _ := ioutil.ReadAll(req.Body)
+		assert.EqualValues(t, "zip content", string(content))
+		assert.EqualValues(t, 11, req.ContentLength)
+	}
+
+	_, err = File("application/zip", filepath.Join(t.TempDir(), "missing.zip"))
+	assert.NotNil(t, err)
+}
+
+func TestReaderBodyIsNotRetried(t *testing.T) {
+	sent := useResponses(t, fastRetries, status(http.StatusBadGateway), status(http.StatusOK))
+
+	response, err := Put(context.Background(), "https://uploads.github.com/asset", Reader("text/plain", strings.NewReader("stream"), -1), nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusBadGateway, response.StatusCode)
+	assert.EqualValues(t, 1, len(*sent))
+	content, _ := ioutil.ReadAll((*sent)[0].Body)
+	assert.EqualValues(t, "stream", string(content))
+}
+
+func TestMultipartBody(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "archive.tar.gz")
+	assert.Nil(t, ioutil.WriteFile(file, []byte("from disk"), 0600))
+	server := useServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, r.ParseMultipartForm(1<<20))
+		assert.EqualValues(t, "golang-import", r.FormValue("name"))
+		for field, expected := range map[string]string{"data": "in memory", "archive": "from disk", "stream": "from a reader"} {
+			part, header, err := r.FormFile(field)
+			if assert.Nil(t, err, field) {
+				content, _ := ioutil.ReadAll(part)
+				assert.EqualValues(t, expected, string(content))
+				assert.NotEmpty(t, header.Filename)
+			}
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	multipart := NewMultipart().
+		Field("name", "golang-import").
+		File("data", "data.json", []byte("in memory")).
+		FileFromPath("archive", file).
+		FileFromReader("stream", "stream.txt", strings.NewReader("from a reader"))
+	assert.True(t, multipart.Body().once)
+	assert.True(t, strings.HasPrefix(multipart.Body().ContentType, "multipart/form-data; boundary="))
+
+	response, err := Post(context.Background(), server.URL, multipart, nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusCreated, response.StatusCode)
+}
+
+func TestMultipartBodyIsSentOnEveryAttempt(t *testing.T) {
+	body := NewMultipart().Field("name", "a").File("data", "data.txt", []byte("content")).Body()
+	assert.False(t, body.once)
+	sent := useResponses(t, fastRetries, status(http.StatusBadGateway), status(http.StatusOK))
+
+	response, err := Put(context.Background(), "https://uploads.github.com/import", body, nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, response.StatusCode)
+	assert.EqualValues(t, 2, len(*sent))
+	for _, req := range *sent {
+		assert.Nil(t, req.ParseMultipartForm(1<<20))
+		assert.EqualValues(t, "a", req.FormValue("name"))
+	}
+}
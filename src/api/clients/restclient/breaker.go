@@ -0,0 +1,214 @@
+package restclient
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/log"
+	"github.com/jebo87/golang-microservices/src/api/metrics"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+//ErrCircuitOpen is returned, wrapped with the host, by calls rejected
+//without being sent because the circuit breaker of the host is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+//BreakerSettings configures the circuit breaker kept for every host. The
+//breaker opens when, within a Window, at least MinRequests calls were made
+//and the ratio of them that failed reaches FailureRatio. Calls fail fast while
+//it is open; after CoolDown, HalfOpenRequests trial calls are let through and
+//the breaker closes again if all of them succeed.
+//A call fails when it gets no response or a 5xx response.
+type BreakerSettings struct {
+	Enabled          bool
+	FailureRatio     float64
+	MinRequests      int
+	Window           time.Duration
+	CoolDown         time.Duration
+	HalfOpenRequests int
+}
+
+//BreakerState is the state of the circuit breaker of a host.
+type BreakerState struct {
+	Host      string     `json:"host"`
+	State     string     `json:"state"`
+	Requests  int        `json:"requests"`
+	Failures  int        `json:"failures"`
+	OpenUntil *time.Time `json:"open_until,omitempty"`
+}
+
+var (
+	DefaultBreakerSettings = BreakerSettings{
+		Enabled:          true,
+		FailureRatio:     0.5,
+		MinRequests:      10,
+		Window:           30 * time.Second,
+		CoolDown:         30 * time.Second,
+		HalfOpenRequests: 1,
+	}
+
+	breakerSettings atomic.Value
+
+	//now is swapped by tests to move the clock.
+	now = time.Now
+)
+
+func init() {
+	breakerSettings.Store(DefaultBreakerSettings)
+}
+
+//SetBreakerSettings changes the settings of every circuit breaker.
+func SetBreakerSettings(settings BreakerSettings) {
+	breakerSettings.Store(settings)
+}
+
+//GetBreakerSettings returns the settings of the circuit breakers.
+func GetBreakerSettings() BreakerSettings {
+	return breakerSettings.Load().(BreakerSettings)
+}
+
+//GetBreakerStates returns the state of the circuit breaker of every host called so far.
+func GetBreakerStates() []BreakerState {
+	shared.breakersMutex.Lock()
+	hosts := make([]string, 0, len(shared.breakers))
+	for host := range shared.breakers {
+		hosts = append(hosts, host)
+	}
+	shared.breakersMutex.Unlock()
+	sort.Strings(hosts)
+
+	settings := GetBreakerSettings()
+	states := make([]BreakerState, 0, len(hosts))
+	for _, host := range hosts {
+		states = append(states, shared.breakerFor(host).snapshot(settings))
+	}
+	return states
+}
+
+//ResetBreakers forgets the state of every circuit breaker.
+func ResetBreakers() {
+	shared.breakersMutex.Lock()
+	defer shared.breakersMutex.Unlock()
+	shared.breakers = make(map[string]*breaker)
+}
+
+func (s *state) breakerFor(host string) *breaker {
+	s.breakersMutex.Lock()
+	defer s.breakersMutex.Unlock()
+	b, ok := s.breakers[host]
+	if !ok {
+		b = &breaker{host: host, state: BreakerClosed, windowStart: now()}
+		s.breakers[host] = b
+	}
+	return b
+}
+
+type breaker struct {
+	mutex       sync.Mutex
+	host        string
+	state       string
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int
+	successes   int
+}
+
+//allow returns an error wrapping ErrCircuitOpen when the call must not be sent.
+func (b *breaker) allow(settings BreakerSettings) error {
+	if !settings.Enabled {
+		return nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == BreakerOpen {
+		if now().Before(b.openedAt.Add(settings.CoolDown)) {
+			return fmt.Errorf("%w for %s", ErrCircuitOpen, b.host)
+		}
+		b.transition(BreakerHalfOpen)
+	}
+	if b.state == BreakerHalfOpen {
+		if b.probes >= settings.HalfOpenRequests {
+			return fmt.Errorf("%w for %s", ErrCircuitOpen, b.host)
+		}
+		b.probes++
+	}
+	return nil
+}
+
+//record counts the outcome of a call let through by allow. Calls given up
+//by the caller are neither a success nor a failure.
+func (b *breaker) record(settings BreakerSettings, failed bool, abandoned bool) {
+	if !settings.Enabled {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case BreakerHalfOpen:
+		switch {
+		case abandoned:
+			b.probes--
+		case failed:
+			b.transition(BreakerOpen)
+		default:
+			b.successes++
+			if b.successes >= settings.HalfOpenRequests {
+				b.transition(BreakerClosed)
+			}
+		}
+	case BreakerClosed:
+		if abandoned {
+			return
+		}
+		if now().Sub(b.windowStart) > settings.Window {
+			b.windowStart, b.requests, b.failures = now(), 0, 0
+		}
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= settings.MinRequests && float64(b.failures)/float64(b.requests) >= settings.FailureRatio {
+			b.transition(BreakerOpen)
+		}
+	}
+}
+
+//transition must be called holding the mutex.
+func (b *breaker) transition(state string) {
+	previous := b.state
+	b.state = state
+	b.probes, b.successes = 0, 0
+	switch state {
+	case BreakerOpen:
+		b.openedAt = now()
+		log.Warn("circuit breaker opened", log.String("host", b.host), log.Int("requests", b.requests), log.Int("failures", b.failures))
+	case BreakerClosed:
+		b.windowStart, b.requests, b.failures = now(), 0, 0
+		log.Info("circuit breaker closed", log.String("host", b.host))
+	}
+	metrics.SetCircuitBreakerState(b.host, previous, state)
+}
+
+func (b *breaker) snapshot(settings BreakerSettings) BreakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	state := BreakerState{Host: b.host, State: b.state, Requests: b.requests, Failures: b.failures}
+	if b.state == BreakerOpen {
+		until := b.openedAt.Add(settings.CoolDown)
+		state.OpenUntil = &until
+	}
+	return state
+}
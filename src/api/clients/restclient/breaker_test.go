@@ -0,0 +1,140 @@
+package restclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func useBreakerSettings(t *testing.T, settings BreakerSettings) *time.Time {
+	previous := GetBreakerSettings()
+	clock := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	SetBreakerSettings(settings)
+	ResetBreakers()
+	t.Cleanup(func() {
+		now = time.Now
+		SetBreakerSettings(previous)
+		ResetBreakers()
+	})
+	return &clock
+}
+
+var testBreaker = BreakerSettings{
+	Enabled:          true,
+	FailureRatio:     0.5,
+	MinRequests:      4,
+	Window:           time.Minute,
+	CoolDown:         10 * time.Second,
+	HalfOpenRequests: 2,
+}
+
+func TestBreakerOpensAndFailsFast(t *testing.T) {
+	useBreakerSettings(t, testBreaker)
+	sent := useResponses(t, RetryPolicy{MaxAttempts: 1},
+		status(http.StatusOK), status(http.StatusBadGateway), failure, status(http.StatusInternalServerError))
+
+	for i := 0; i < 4; i++ {
+		_, _ = Get(context.Background(), "https://api.github.com/a", nil)
+	}
+	response, err := Get(context.Background(), "https://api.github.com/a", nil)
+	assert.Nil(t, response)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.EqualValues(t, "circuit breaker is open for api.github.com", err.Error())
+	assert.EqualValues(t, 4, len(*sent))
+
+	states := GetBreakerStates()
+	assert.EqualValues(t, 1, len(states))
+	assert.EqualValues(t, BreakerOpen, states[0].State)
+	assert.EqualValues(t, "api.github.com", states[0].Host)
+	assert.NotNil(t, states[0].OpenUntil)
+}
+
+func TestBreakerIsPerHost(t *testing.T) {
+	useBreakerSettings(t, BreakerSettings{Enabled: true, FailureRatio: 1, MinRequests: 1, Window: time.Minute, CoolDown: time.Minute, HalfOpenRequests: 1})
+	useResponses(t, RetryPolicy{MaxAttempts: 1}, failure, status(http.StatusOK))
+
+	_, _ = Get(context.Background(), "https://down.example.com/a", nil)
+	_, err := Get(context.Background(), "https://down.example.com/a", nil)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+
+	response, err := Get(context.Background(), "https://up.example.com/a", nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, response.StatusCode)
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	clock := useBreakerSettings(t, testBreaker)
+	b := shared.breakerFor("api.github.com")
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, b.allow(testBreaker))
+		b.record(testBreaker, true, false)
+	}
+	assert.EqualValues(t, BreakerOpen, b.snapshot(testBreaker).State)
+
+	*clock = clock.Add(11 * time.Second)
+	assert.Nil(t, b.allow(testBreaker))
+	assert.Nil(t, b.allow(testBreaker))
+	//only HalfOpenRequests trial calls are let through
+	assert.True(t, errors.Is(b.allow(testBreaker), ErrCircuitOpen))
+	assert.EqualValues(t, BreakerHalfOpen, b.snapshot(testBreaker).State)
+
+	//a failed trial opens the breaker again
+	b.record(testBreaker, true, false)
+	assert.EqualValues(t, BreakerOpen, b.snapshot(testBreaker).State)
+
+	*clock = clock.Add(11 * time.Second)
+	assert.Nil(t, b.allow(testBreaker))
+	assert.Nil(t, b.allow(testBreaker))
+	b.record(testBreaker, false, false)
+	assert.EqualValues(t, BreakerHalfOpen, b.snapshot(testBreaker).State)
+	b.record(testBreaker, false, false)
+	assert.EqualValues(t, BreakerClosed, b.snapshot(testBreaker).State)
+	assert.EqualValues(t, 0, b.snapshot(testBreaker).Failures)
+}
+
+func TestBreakerWindowAndDisabled(t *testing.T) {
+	clock := useBreakerSettings(t, testBreaker)
+	b := shared.breakerFor("api.github.com")
+	for i := 0; i < 3; i++ {
+		b.record(testBreaker, true, false)
+	}
+	//failures of a past window are forgotten
+	*clock = clock.Add(2 * time.Minute)
+	b.record(testBreaker, true, false)
+	assert.EqualValues(t, BreakerClosed, b.snapshot(testBreaker).State)
+	assert.EqualValues(t, 1, b.snapshot(testBreaker).Requests)
+
+	//abandoned calls are not counted
+	b.record(testBreaker, false, true)
+	assert.EqualValues(t, 1, b.snapshot(testBreaker).Requests)
+
+	disabled := testBreaker
+	disabled.Enabled = false
+	for i := 0; i < 10; i++ {
+		b.record(disabled, true, false)
+	}
+	assert.Nil(t, b.allow(disabled))
+	assert.EqualValues(t, BreakerClosed, b.snapshot(testBreaker).State)
+}
+
+func TestBreakersOfContextClientsAreTheirOwn(t *testing.T) {
+	useBreakerSettings(t, BreakerSettings{Enabled: true, FailureRatio: 1, MinRequests: 1, Window: time.Minute, CoolDown: time.Minute, HalfOpenRequests: 1})
+	useResponses(t, RetryPolicy{MaxAttempts: 1})
+	down := ContextWithClient(context.Background(), ClientFunc(failure))
+	up := ContextWithClient(context.Background(), ClientFunc(status(http.StatusOK)))
+
+	_, _ = Get(down, "https://api.github.com/a", nil)
+	_, err := Get(down, "https://api.github.com/a", nil)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+
+	response, err := Get(up, "https://api.github.com/a", nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, response.StatusCode)
+	//the breakers of the package state are untouched
+	assert.EqualValues(t, 0, len(GetBreakerStates()))
+}
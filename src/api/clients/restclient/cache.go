@@ -0,0 +1,310 @@
+package restclient
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jebo87/golang-microservices/src/api/log"
+	"github.com/jebo87/golang-microservices/src/api/metrics"
+)
+
+const (
+	headerETag        = "ETag"
+	headerIfNoneMatch = "If-None-Match"
+
+	DefaultCacheEntries = 1000
+)
+
+//CachedResponse is a response kept by a CacheStore, sent back to the caller
+//when the host answers the next request for the same url with 304 Not Modified.
+type CachedResponse struct {
+	ETag   string
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+//CacheStore keeps the cached responses by key. Implementations must be safe
+//for concurrent use and must not change the responses given to Set or
+//returned by Get.
+type CacheStore interface {
+	Get(key string) (CachedResponse, bool)
+	Set(key string, response CachedResponse)
+	Delete(key string)
+}
+
+//CacheSettings configures the cache of GET responses. Responses with an ETag
+//and a body of at most MaxBodyBytes are stored for every url and token, later
+//requests for them are sent with If-None-Match.
+type CacheSettings struct {
+	Enabled      bool
+	MaxBodyBytes int
+}
+
+//storeHolder lets atomic.Value keep any CacheStore implementation.
+type storeHolder struct {
+	store CacheStore
+}
+
+var (
+	DefaultCacheSettings = CacheSettings{
+		Enabled:      true,
+		MaxBodyBytes: 256 << 10,
+	}
+
+	cacheSettings atomic.Value
+	cacheStore    atomic.Value
+)
+
+func init() {
+	cacheSettings.Store(DefaultCacheSettings)
+	cacheStore.Store(storeHolder{NewLRUCache(DefaultCacheEntries)})
+}
+
+//SetCacheSettings changes the settings of the cache.
+func SetCacheSettings(settings CacheSettings) {
+	cacheSettings.Store(settings)
+}
+
+//GetCacheSettings returns the settings of the cache.
+func GetCacheSettings() CacheSettings {
+	return cacheSettings.Load().(CacheSettings)
+}
+
+//SetCacheStore replaces the store of the cached responses, an in-memory
+//LRUCache of DefaultCacheEntries by default.
+func SetCacheStore(store CacheStore) {
+	cacheStore.Store(storeHolder{store})
+}
+
+//GetCacheStore returns the store of the cached responses.
+func GetCacheStore() CacheStore {
+	return cacheStore.Load().(storeHolder).store
+}
+
+//cacheKey tells apart the responses of every token, the Authorization header
+//is hashed so the stores never hold the tokens.
+func cacheKey(url string, headers http.Header) string {
+	authorization := headers.Get(headerAuthorization)
+	if authorization == "" {
+		return url
+	}
+	sum := sha256.Sum256([]byte(authorization))
+	return url + " " + hex.EncodeToString(sum[:])
+}
+
+//caching answers the GET calls from the cache. It runs after the
+//interceptors of the caller so the cache keys include the Authorization
+//header they set.
+func caching(next HTTPClient) HTTPClient {
+	return ClientFunc(func(req *http.Request) (*http.Response, error) {
+		cache := lookupCache(stateFromContext(req.Context()).cacheStore(), req.Method, req.URL.String(), req.URL.Host, req.Header)
+		if cache == nil {
+			return next.Do(req)
+		}
+		req.Header = cache.headers(req.Header)
+		response, err := next.Do(req)
+		if err != nil {
+			return response, err
+		}
+		return cache.complete(req.Context(), response)
+	})
+}
+
+//cacheLookup is the cache state of a single call.
+type cacheLookup struct {
+	store    CacheStore
+	settings CacheSettings
+	host     string
+	key      string
+	entry    CachedResponse
+	found    bool
+}
+
+//lookupCache returns nil when the call can't use the cache: it isn't a GET,
+//the cache is disabled or the caller sends its own conditional headers.
+func lookupCache(store CacheStore, method string, url string, host string, headers http.Header) *cacheLookup {
+	settings := GetCacheSettings()
+	if !settings.Enabled || method != http.MethodGet || headers.Get(headerIfNoneMatch) != "" {
+		return nil
+	}
+	c := &cacheLookup{store: store, settings: settings, host: host, key: cacheKey(url, headers)}
+	c.entry, c.found = c.store.Get(c.key)
+	return c
+}
+
+//headers adds If-None-Match to the headers of the call when a response is cached.
+func (c *cacheLookup) headers(headers http.Header) http.Header {
+	if !c.found {
+		return headers
+	}
+	headers = headers.Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+	headers.Set(headerIfNoneMatch, c.entry.ETag)
+	return headers
+}
+
+//complete answers a 304 with the cached response and stores the new ones.
+func (c *cacheLookup) complete(ctx context.Context, response *http.Response) (*http.Response, error) {
+	switch {
+	case response.StatusCode == http.StatusNotModified && c.found:
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+		metrics.ObserveUpstreamCache(c.host, metrics.CacheHit)
+		log.DebugContext(ctx, "response served from cache", log.String("host", c.host), log.String("etag", c.entry.ETag))
+		return c.replay(response), nil
+	case response.StatusCode == http.StatusOK:
+		metrics.ObserveUpstreamCache(c.host, metrics.CacheMiss)
+		etag := response.Header.Get(headerETag)
+		if etag == "" || strings.Contains(response.Header.Get("Cache-Control"), "no-store") {
+			c.forget()
+			return response, nil
+		}
+		return c.save(response, etag)
+	case response.StatusCode == http.StatusNotFound || response.StatusCode == http.StatusGone:
+		c.forget()
+	}
+	return response, nil
+}
+
+//replay builds the response of a 304 from the cached one, with the headers
+//of the 304 taking precedence as they are the most recent.
+func (c *cacheLookup) replay(notModified *http.Response) *http.Response {
+	header := c.entry.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	for name, values := range notModified.Header {
+		if name != "Content-Length" {
+			header[name] = values
+		}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", c.entry.Status, http.StatusText(c.entry.Status)),
+		StatusCode:    c.entry.Status,
+		Proto:         notModified.Proto,
+		ProtoMajor:    notModified.ProtoMajor,
+		ProtoMinor:    notModified.ProtoMinor,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(c.entry.Body)),
+		ContentLength: int64(len(c.entry.Body)),
+		Request:       notModified.Request,
+	}
+}
+
+//save reads the body to store it. Bodies longer than MaxBodyBytes are not
+//stored and are given back to the caller as they are.
+func (c *cacheLookup) save(response *http.Response, etag string) (*http.Response, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, int64(c.settings.MaxBodyBytes)+1))
+	if err != nil {
+		response.Body.Close()
+		return nil, err
+	}
+	if len(body) > c.settings.MaxBodyBytes {
+		c.forget()
+		response.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), response.Body), Closer: response.Body}
+		return response, nil
+	}
+	response.Body.Close()
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+	c.store.Set(c.key, CachedResponse{ETag: etag, Status: response.StatusCode, Header: response.Header.Clone(), Body: body})
+	return response, nil
+}
+
+func (c *cacheLookup) forget() {
+	if c.found {
+		c.store.Delete(c.key)
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+//LRUCache is an in-memory CacheStore that drops the least recently used
+//responses once it holds more than its max entries.
+type LRUCache struct {
+	mutex      sync.Mutex
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+}
+
+type lruEntry struct {
+	key      string
+	response CachedResponse
+}
+
+func NewLRUCache(maxEntries int) *LRUCache {
+	return &LRUCache{maxEntries: maxEntries, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *LRUCache) Get(key string) (CachedResponse, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return CachedResponse{}, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*lruEntry).response, true
+}
+
+func (c *LRUCache) Set(key string, response CachedResponse) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*lruEntry).response = response
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, response: response})
+	c.evict()
+}
+
+func (c *LRUCache) Delete(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+//Len returns the number of responses stored.
+func (c *LRUCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+//Resize changes the max entries, dropping the least recently used responses
+//that don't fit anymore.
+func (c *LRUCache) Resize(maxEntries int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.maxEntries = maxEntries
+	c.evict()
+}
+
+//evict must be called holding the mutex.
+func (c *LRUCache) evict() {
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
@@ -0,0 +1,170 @@
+package restclient
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jebo87/golang-microservices/src/api/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func useCache(t *testing.T, settings CacheSettings, maxEntries int) *LRUCache {
+	previousSettings := GetCacheSettings()
+	previousStore := GetCacheStore()
+	t.Cleanup(func() {
+		SetCacheSettings(previousSettings)
+		SetCacheStore(previousStore)
+	})
+	store := NewLRUCache(maxEntries)
+	SetCacheSettings(settings)
+	SetCacheStore(store)
+	return store
+}
+
+func respond(code int, body string, headers ...string) func(*http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		response, _ := status(code, headers...)(req)
+		response.Body = ioutil.NopCloser(strings.NewReader(body))
+		return response, nil
+	}
+}
+
+func readBody(t *testing.T, response *http.Response) string {
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	assert.Nil(t, err)
+	return string(body)
+}
+
+func TestCacheServesNotModified(t *testing.T) {
+	useCache(t, DefaultCacheSettings, 10)
+	sent := useResponses(t, fastRetries,
+		respond(http.StatusOK, `{"name":"repo"}`, "ETag", `"v1"`, "Content-Type", "application/json"),
+		respond(http.StatusNotModified, "", "ETag", `"v1"`, "X-RateLimit-Remaining", "4999"))
+	headers := http.Header{"Authorization": {"token abc"}}
+
+	response, err := Get(context.Background(), "https://cache.example.com/repos/a/b", headers)
+	assert.Nil(t, err)
+	assert.EqualValues(t, `{"name":"repo"}`, readBody(t, response))
+
+	response, err = Get(context.Background(), "https://cache.example.com/repos/a/b", headers)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, response.StatusCode)
+	assert.EqualValues(t, "application/json", response.Header.Get("Content-Type"))
+	assert.EqualValues(t, "4999", response.Header.Get("X-RateLimit-Remaining"))
+	assert.EqualValues(t, `{"name":"repo"}`, readBody(t, response))
+
+	assert.EqualValues(t, 2, len(*sent))
+	assert.EqualValues(t, "", (*sent)[0].Header.Get("If-None-Match"))
+	assert.EqualValues(t, `"v1"`, (*sent)[1].Header.Get("If-None-Match"))
+	assert.Nil(t, headers["If-None-Match"])
+
+	scraped := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(scraped, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, scraped.Body.String(), `api_upstream_cache_total{host="cache.example.com",result="hit"} 1`)
+	assert.Contains(t, scraped.Body.String(), `api_upstream_cache_total{host="cache.example.com",result="miss"} 1`)
+}
+
+func TestCacheKeyedByToken(t *testing.T) {
+	store := useCache(t, DefaultCacheSettings, 10)
+	sent := useResponses(t, fastRetries,
+		respond(http.StatusOK, "first", "ETag", `"v1"`),
+		respond(http.StatusOK, "second", "ETag", `"v2"`))
+
+	response, _ := Get(context.Background(), "https://api.github.com/user", http.Header{"Authorization": {"token a"}})
+	assert.EqualValues(t, "first", readBody(t, response))
+	response, _ = Get(context.Background(), "https://api.github.com/user", http.Header{"Authorization": {"token b"}})
+	assert.EqualValues(t, "second", readBody(t, response))
+
+	assert.EqualValues(t, "", (*sent)[1].Header.Get("If-None-Match"))
+	assert.EqualValues(t, 2, store.Len())
+	for _, element := range store.entries {
+		assert.NotContains(t, element.Value.(*lruEntry).key, "token")
+	}
+}
+
+func TestCacheUpdatesChangedResponses(t *testing.T) {
+	useCache(t, DefaultCacheSettings, 10)
+	sent := useResponses(t, fastRetries,
+		respond(http.StatusOK, "first", "ETag", `"v1"`),
+		respond(http.StatusOK, "second", "ETag", `"v2"`),
+		respond(http.StatusNotModified, ""))
+
+	for _, expected := range []string{"first", "second", "second"} {
+		response, err := Get(context.Background(), "https://api.github.com/user", nil)
+		assert.Nil(t, err)
+		assert.EqualValues(t, expected, readBody(t, response))
+	}
+	assert.EqualValues(t, `"v2"`, (*sent)[2].Header.Get("If-None-Match"))
+}
+
+func TestCacheSkipsUncacheableResponses(t *testing.T) {
+	store := useCache(t, CacheSettings{Enabled: true, MaxBodyBytes: 5}, 10)
+	useResponses(t, fastRetries,
+		respond(http.StatusOK, "no etag"),
+		respond(http.StatusOK, "too long", "ETag", `"v1"`),
+		respond(http.StatusOK, "store", "ETag", `"v1"`, "Cache-Control", "private, no-store"),
+		respond(http.StatusCreated, "post", "ETag", `"v1"`))
+
+	response, _ := Get(context.Background(), "https://api.github.com/a", nil)
+	assert.EqualValues(t, "no etag", readBody(t, response))
+	response, _ = Get(context.Background(), "https://api.github.com/b", nil)
+	assert.EqualValues(t, "too long", readBody(t, response))
+	response, _ = Get(context.Background(), "https://api.github.com/c", nil)
+	assert.EqualValues(t, "store", readBody(t, response))
+	response, _ = Post(context.Background(), "https://api.github.com/d", nil, nil)
+	assert.EqualValues(t, "post", readBody(t, response))
+
+	assert.EqualValues(t, 0, store.Len())
+}
+
+func TestCacheForgetsDeletedResources(t *testing.T) {
+	store := useCache(t, DefaultCacheSettings, 10)
+	sent := useResponses(t, fastRetries,
+		respond(http.StatusOK, "repo", "ETag", `"v1"`),
+		respond(http.StatusNotFound, "gone"),
+		respond(http.StatusOK, "repo", "ETag", `"v2"`))
+
+	for i := 0; i < 3; i++ {
+		response, _ := Get(context.Background(), "https://api.github.com/repos/a/b", nil)
+		readBody(t, response)
+	}
+	assert.EqualValues(t, "", (*sent)[2].Header.Get("If-None-Match"))
+	assert.EqualValues(t, 1, store.Len())
+}
+
+func TestCacheDisabled(t *testing.T) {
+	store := useCache(t, CacheSettings{Enabled: false, MaxBodyBytes: 1024}, 10)
+	sent := useResponses(t, fastRetries, respond(http.StatusOK, "one", "ETag", `"v1"`), respond(http.StatusOK, "two", "ETag", `"v1"`))
+
+	Get(context.Background(), "https://api.github.com/user", nil)
+	Get(context.Background(), "https://api.github.com/user", nil)
+	assert.EqualValues(t, "", (*sent)[1].Header.Get("If-None-Match"))
+	assert.EqualValues(t, 0, store.Len())
+}
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	store := NewLRUCache(2)
+	store.Set("a", CachedResponse{ETag: "a"})
+	store.Set("b", CachedResponse{ETag: "b"})
+	store.Get("a")
+	store.Set("c", CachedResponse{ETag: "c"})
+
+	_, ok := store.Get("b")
+	assert.False(t, ok)
+	entry, ok := store.Get("a")
+	assert.True(t, ok)
+	assert.EqualValues(t, "a", entry.ETag)
+
+	store.Resize(1)
+	assert.EqualValues(t, 1, store.Len())
+	_, ok = store.Get("a")
+	assert.True(t, ok)
+
+	store.Delete("a")
+	assert.EqualValues(t, 0, store.Len())
+}
@@ -0,0 +1,75 @@
+package restclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+const DefaultMaxResponseBytes = 10 << 20
+
+var (
+	ErrBodyTooLarge          = errors.New("response body too large")
+	ErrUnexpectedContentType = errors.New("unexpected content type")
+	//ErrInvalidJSON is wrapped by the errors of bodies read but not decoded.
+	ErrInvalidJSON = errors.New("invalid json body")
+
+	//maxResponseBytes is the largest body decoded by DecodeJSON, stored as
+	//an int64 so it can be changed while requests are running.
+	maxResponseBytes int64 = DefaultMaxResponseBytes
+)
+
+//SetMaxResponseBytes changes the largest body decoded by DecodeJSON.
+func SetMaxResponseBytes(n int64) {
+	atomic.StoreInt64(&maxResponseBytes, n)
+}
+
+//ReadBody reads and closes the body of response, failing with
+//ErrBodyTooLarge when it is longer than maxBytes.
+func ReadBody(response *http.Response, maxBytes int64) ([]byte, error) {
+	defer response.Body.Close()
+	if response.ContentLength > maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes, at most %d are read", ErrBodyTooLarge, response.ContentLength, maxBytes)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, fmt.Errorf("%w: at most %d bytes are read", ErrBodyTooLarge, maxBytes)
+	}
+	return body, nil
+}
+
+//DecodeJSON decodes the json body of response into v and closes the body.
+//The body must be at most the size given to SetMaxResponseBytes and, when the
+//response tells its Content-Type, be application/json or a +json type such as
+//application/vnd.github+json.
+func DecodeJSON(response *http.Response, v interface{}) error {
+	if contentType := response.Header.Get("Content-Type"); contentType != "" && !isJSON(contentType) {
+		response.Body.Close()
+		return fmt.Errorf("%w %s, expected json", ErrUnexpectedContentType, contentType)
+	}
+	body, err := ReadBody(response, atomic.LoadInt64(&maxResponseBytes))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidJSON, err)
+	}
+	return nil
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
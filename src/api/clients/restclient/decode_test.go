@@ -0,0 +1,61 @@
+package restclient
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func jsonResponse(contentType string, body string) *http.Response {
+	response := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, ContentLength: -1, Body: ioutil.NopCloser(strings.NewReader(body))}
+	if contentType != "" {
+		response.Header.Set("Content-Type", contentType)
+	}
+	return response
+}
+
+func TestDecodeJSON(t *testing.T) {
+	for _, contentType := range []string{"application/json; charset=utf-8", "application/vnd.github+json", ""} {
+		var repo struct {
+			Name string `json:"name"`
+		}
+		assert.Nil(t, DecodeJSON(jsonResponse(contentType, `{"name":"golang"}`), &repo), contentType)
+		assert.EqualValues(t, "golang", repo.Name)
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	var v map[string]interface{}
+
+	err := DecodeJSON(jsonResponse("text/html", `<html></html>`), &v)
+	assert.True(t, errors.Is(err, ErrUnexpectedContentType))
+	assert.EqualValues(t, "unexpected content type text/html, expected json", err.Error())
+
+	err = DecodeJSON(jsonResponse("application/json", `{"name":`), &v)
+	assert.True(t, errors.Is(err, ErrInvalidJSON))
+
+	SetMaxResponseBytes(8)
+	defer SetMaxResponseBytes(DefaultMaxResponseBytes)
+	err = DecodeJSON(jsonResponse("application/json", `{"name":"golang"}`), &v)
+	assert.True(t, errors.Is(err, ErrBodyTooLarge))
+	assert.False(t, errors.Is(err, ErrInvalidJSON))
+}
+
+func TestReadBodyLimit(t *testing.T) {
+	body, err := ReadBody(jsonResponse("", "12345"), 5)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "12345", string(body))
+
+	_, err = ReadBody(jsonResponse("", "123456"), 5)
+	assert.EqualValues(t, "response body too large: at most 5 bytes are read", err.Error())
+
+	//the announced length is checked before reading
+	response := jsonResponse("", "")
+	response.ContentLength = 1 << 30
+	_, err = ReadBody(response, 5)
+	assert.EqualValues(t, "response body too large: 1073741824 bytes, at most 5 are read", err.Error())
+}
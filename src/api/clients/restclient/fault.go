@@ -0,0 +1,127 @@
+package restclient
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/log"
+	"github.com/jebo87/golang-microservices/src/api/metrics"
+)
+
+const headerInjectedFault = "X-Injected-Fault"
+
+//ErrInjectedFault is wrapped by the errors of the calls failed by a Fault.
+var ErrInjectedFault = errors.New("injected fault")
+
+//Fault is injected in Percent (0 to 100) of the calls to Host, any host when
+//empty, whose path starts with PathPrefix. The call waits Delay and then
+//fails with Error, is answered with Status without being sent, or is sent as
+//usual when neither is set.
+type Fault struct {
+	Host       string
+	PathPrefix string
+	Percent    float64
+	Delay      time.Duration
+	Status     int
+	Error      string
+}
+
+func (f Fault) matches(req *http.Request) bool {
+	return (f.Host == "" || strings.EqualFold(f.Host, req.URL.Host)) && strings.HasPrefix(req.URL.Path, f.PathPrefix)
+}
+
+var (
+	faults atomic.Value
+
+	//faultSample is swapped by tests to choose the calls getting a fault.
+	faultSample = rand.Float64
+)
+
+func init() {
+	faults.Store([]Fault(nil))
+}
+
+//SetFaults changes the faults injected by FaultInjection, none disables it.
+//The configuration refuses to set them in production.
+func SetFaults(injected []Fault) {
+	faults.Store(append([]Fault(nil), injected...))
+}
+
+//GetFaults returns the faults injected by FaultInjection.
+func GetFaults() []Fault {
+	return faults.Load().([]Fault)
+}
+
+//FaultInjection injects the first of the faults given to SetFaults matching
+//every call. It runs last, so retries, circuit breakers, logs and metrics
+//handle the faults as they would handle real ones.
+func FaultInjection() Interceptor {
+	return func(next HTTPClient) HTTPClient {
+		return ClientFunc(func(req *http.Request) (*http.Response, error) {
+			fault, ok := faultFor(req)
+			if !ok {
+				return next.Do(req)
+			}
+			ctx, host := req.Context(), req.URL.Host
+			if fault.Delay > 0 {
+				metrics.ObserveInjectedFault(host, metrics.FaultDelay)
+				log.WarnContext(ctx, "delay injected", log.String("host", host), log.String("path", req.URL.Path), log.Duration("delay", fault.Delay))
+				if !sleep(ctx, fault.Delay) {
+					closeBody(req)
+					return nil, ctx.Err()
+				}
+			}
+			switch {
+			case fault.Error != "":
+				metrics.ObserveInjectedFault(host, metrics.FaultError)
+				log.WarnContext(ctx, "error injected", log.String("host", host), log.String("path", req.URL.Path), log.String("error", fault.Error))
+				closeBody(req)
+				return nil, fmt.Errorf("%w: %s", ErrInjectedFault, fault.Error)
+			case fault.Status != 0:
+				metrics.ObserveInjectedFault(host, metrics.FaultStatus)
+				log.WarnContext(ctx, "status injected", log.String("host", host), log.String("path", req.URL.Path), log.Int("status", fault.Status))
+				closeBody(req)
+				return injectedResponse(req, fault.Status), nil
+			}
+			return next.Do(req)
+		})
+	}
+}
+
+//closeBody closes the body of a request never sent, as the transport would,
+//stopping the writer of a multipart body and closing its files.
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+func faultFor(req *http.Request) (Fault, bool) {
+	for _, fault := range GetFaults() {
+		if fault.matches(req) {
+			return fault, faultSample()*100 < fault.Percent
+		}
+	}
+	return Fault{}, false
+}
+
+func injectedResponse(req *http.Request, status int) *http.Response {
+	body := fmt.Sprintf(`{"message":"fault injected with status %d"}`, status)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}, headerInjectedFault: {"true"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
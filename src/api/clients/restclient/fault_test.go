@@ -0,0 +1,113 @@
+package restclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func useFaults(t *testing.T, sample float64, injected ...Fault) {
+	previousSample := faultSample
+	t.Cleanup(func() {
+		faultSample = previousSample
+		SetFaults(nil)
+	})
+	faultSample = func() float64 { return sample }
+	SetFaults(injected)
+}
+
+func TestInjectedStatusIsRetried(t *testing.T) {
+	useFaults(t, 0, Fault{Host: "faults.example.com", Percent: 100, Status: http.StatusServiceUnavailable})
+	sent := useResponses(t, fastRetries)
+
+	response, err := Get(context.Background(), "https://faults.example.com/user/repos", nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusServiceUnavailable, response.StatusCode)
+	assert.EqualValues(t, "true", response.Header.Get(headerInjectedFault))
+	assert.EqualValues(t, `{"message":"fault injected with status 503"}`, readBody(t, response))
+	assert.EqualValues(t, 0, len(*sent))
+
+	scraped := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(scraped, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, scraped.Body.String(), `api_upstream_injected_faults_total{fault="status",host="faults.example.com"} 3`)
+}
+
+func TestInjectedError(t *testing.T) {
+	useFaults(t, 0, Fault{PathPrefix: "/user", Percent: 100, Error: "connection reset by peer"})
+	useResponses(t, RetryPolicy{MaxAttempts: 1})
+
+	_, err := Get(context.Background(), "https://faults.example.com/user/repos", nil)
+	assert.True(t, errors.Is(err, ErrInjectedFault))
+	assert.EqualValues(t, "injected fault: connection reset by peer", err.Error())
+}
+
+type closedBody struct {
+	*strings.Reader
+	closed bool
+}
+
+func (b *closedBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestInjectedFaultsCloseTheBody(t *testing.T) {
+	next := ClientFunc(func(req *http.Request) (*http.Response, error) {
+		t.Fatal("the request should not be sent")
+		return nil, nil
+	})
+	for _, fault := range []Fault{
+		{Percent: 100, Status: http.StatusServiceUnavailable},
+		{Percent: 100, Error: "connection reset by peer"},
+	} {
+		useFaults(t, 0, fault)
+		body := &closedBody{Reader: strings.NewReader(`{"name":"a"}`)}
+		request := httptest.NewRequest(http.MethodPost, "https://faults.example.com/user/repos", body)
+		FaultInjection()(next).Do(request)
+		assert.True(t, body.closed, fault)
+	}
+}
+
+func TestInjectedDelay(t *testing.T) {
+	useFaults(t, 0, Fault{Percent: 100, Delay: 20 * time.Millisecond})
+	sent := useResponses(t, fastRetries, status(http.StatusOK))
+
+	start := time.Now()
+	response, err := Get(context.Background(), "https://faults.example.com/user/repos", nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, response.StatusCode)
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+	assert.EqualValues(t, 1, len(*sent))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err = Get(ctx, "https://faults.example.com/user/repos", nil)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.EqualValues(t, 1, len(*sent))
+}
+
+func TestFaultsOnlyMatchTheirScope(t *testing.T) {
+	//the first matching fault is rolled, a 40% fault misses a sample of 0.5
+	useFaults(t, 0.5,
+		Fault{Host: "faults.example.com", PathPrefix: "/repos", Percent: 40, Status: http.StatusInternalServerError},
+		Fault{Host: "faults.example.com", Percent: 100, Status: http.StatusBadGateway})
+	sent := useResponses(t, RetryPolicy{MaxAttempts: 1}, status(http.StatusOK), status(http.StatusOK))
+
+	for url, expected := range map[string]int{
+		"https://faults.example.com/repos/a/b": http.StatusOK,
+		"https://faults.example.com/user":      http.StatusBadGateway,
+		"https://other.example.com/user":       http.StatusOK,
+	} {
+		response, err := Get(context.Background(), url, nil)
+		assert.Nil(t, err)
+		assert.EqualValues(t, expected, response.StatusCode, url)
+	}
+	assert.EqualValues(t, 2, len(*sent))
+}
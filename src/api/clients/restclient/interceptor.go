@@ -0,0 +1,213 @@
+package restclient
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/log"
+	"github.com/jebo87/golang-microservices/src/api/metrics"
+	"github.com/jebo87/golang-microservices/src/api/utils/request_id"
+)
+
+const (
+	headerAuthorization = "Authorization"
+	headerUserAgent     = "User-Agent"
+
+	DefaultUserAgent = "golang-microservices"
+)
+
+//writeCallLog is swapped by tests to capture the events.
+var writeCallLog = log.InfoContext
+
+//Interceptor wraps the client sending every attempt of a call, to change the
+//request or observe the response. A new request is built for every attempt,
+//so interceptors can change it in place.
+type Interceptor func(next HTTPClient) HTTPClient
+
+//ClientFunc is a function used as an HTTPClient.
+type ClientFunc func(req *http.Request) (*http.Response, error)
+
+func (f ClientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+//Chain wraps client with interceptors, the first one being the outermost.
+func Chain(client HTTPClient, interceptors ...Interceptor) HTTPClient {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		client = interceptors[i](client)
+	}
+	return client
+}
+
+//WithInterceptors adds interceptors to a single request.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(o *requestOptions) {
+		o.interceptors = append(o.interceptors, interceptors...)
+	}
+}
+
+//chainFor returns the client sending an attempt. The interceptors of the
+//caller run after RequestID and UserAgent, so they can override the headers
+//set by them, and before the cache, the log, the metrics and the injected
+//faults, so those see the request as it is sent.
+func chainFor(client HTTPClient, interceptors []Interceptor) HTTPClient {
+	all := []Interceptor{RequestID(), UserAgent(DefaultUserAgent)}
+	all = append(all, interceptors...)
+	all = append(all, caching, Logging(), Metrics(), FaultInjection())
+	return Chain(client, all...)
+}
+
+//RestClient sends its calls through its own interceptors, e.g. the
+//authentication of a provider.
+type RestClient struct {
+	interceptors []Interceptor
+}
+
+func New(interceptors ...Interceptor) *RestClient {
+	return &RestClient{interceptors: interceptors}
+}
+
+func (c *RestClient) options(options []Option) []Option {
+	return append([]Option{WithInterceptors(c.interceptors...)}, options...)
+}
+
+//Get sends a GET request to url.
+func (c *RestClient) Get(ctx context.Context, url string, headers http.Header, options ...Option) (*http.Response, error) {
+	return do(ctx, http.MethodGet, url, nil, headers, c.options(options))
+}
+
+//Post sends body as json to url.
+func (c *RestClient) Post(ctx context.Context, url string, body interface{}, headers http.Header, options ...Option) (*http.Response, error) {
+	return do(ctx, http.MethodPost, url, body, headers, c.options(options))
+}
+
+//Put sends body as json to url.
+func (c *RestClient) Put(ctx context.Context, url string, body interface{}, headers http.Header, options ...Option) (*http.Response, error) {
+	return do(ctx, http.MethodPut, url, body, headers, c.options(options))
+}
+
+//Patch sends body as json to url.
+func (c *RestClient) Patch(ctx context.Context, url string, body interface{}, headers http.Header, options ...Option) (*http.Response, error) {
+	return do(ctx, http.MethodPatch, url, body, headers, c.options(options))
+}
+
+//Delete sends a DELETE request to url.
+func (c *RestClient) Delete(ctx context.Context, url string, headers http.Header, options ...Option) (*http.Response, error) {
+	return do(ctx, http.MethodDelete, url, nil, headers, c.options(options))
+}
+
+//TokenSource returns the token of a call. With an empty token the call is
+//sent without credentials.
+type TokenSource func(ctx context.Context) (string, error)
+
+//StaticToken always returns token.
+func StaticToken(token string) TokenSource {
+	return func(context.Context) (string, error) {
+		return token, nil
+	}
+}
+
+type tokenKey struct{}
+
+//ContextWithToken makes TokenFromContext return token for the calls made
+//with the returned context.
+func ContextWithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+//TokenFromContext is a TokenSource returning the token given to ContextWithToken.
+func TokenFromContext(ctx context.Context) (string, error) {
+	token, _ := ctx.Value(tokenKey{}).(string)
+	return token, nil
+}
+
+//Auth sets the Authorization header of the calls to "scheme token", unless
+//the caller already set one.
+func Auth(scheme string, source TokenSource) Interceptor {
+	return func(next HTTPClient) HTTPClient {
+		return ClientFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(headerAuthorization) != "" {
+				return next.Do(req)
+			}
+			token, err := source(req.Context())
+			if err != nil {
+				return nil, err
+			}
+			if token != "" {
+				req.Header.Set(headerAuthorization, scheme+" "+token)
+			}
+			return next.Do(req)
+		})
+	}
+}
+
+//UserAgent sets the User-Agent header of the calls.
+func UserAgent(agent string) Interceptor {
+	return func(next HTTPClient) HTTPClient {
+		return ClientFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Set(headerUserAgent, agent)
+			return next.Do(req)
+		})
+	}
+}
+
+//RequestID forwards the X-Request-ID stored in the context of the calls, so
+//they can be tied to the request that triggered them.
+func RequestID() Interceptor {
+	return func(next HTTPClient) HTTPClient {
+		return ClientFunc(func(req *http.Request) (*http.Response, error) {
+			if id := request_id.FromContext(req.Context()); id != "" {
+				req.Header.Set(request_id.Header, id)
+			}
+			return next.Do(req)
+		})
+	}
+}
+
+//Logging logs every call, once it is over, with its status, the time spent
+//in every phase and whether its connection was reused.
+func Logging() Interceptor {
+	return func(next HTTPClient) HTTPClient {
+		return ClientFunc(func(req *http.Request) (*http.Response, error) {
+			ctx, method, host := req.Context(), req.Method, req.URL.Host
+			return traceCall(next, req, func(t *timings, response *http.Response, err error) {
+				fields := []log.Field{log.String("method", method), log.String("host", host)}
+				if response != nil {
+					fields = append(fields, log.Int("status", response.StatusCode))
+				}
+				if err != nil {
+					fields = append(fields, log.String("error", err.Error()))
+				}
+				for _, p := range t.phases() {
+					fields = append(fields, log.Duration(p.name, p.duration))
+				}
+				if connected, reused := t.connection(); connected {
+					fields = append(fields, log.Bool("reused", reused))
+				}
+				writeCallLog(ctx, "upstream call", fields...)
+			})
+		})
+	}
+}
+
+//Metrics exports the latency, the errors and the time spent in every phase
+//of the calls, and the connections they used.
+func Metrics() Interceptor {
+	return func(next HTTPClient) HTTPClient {
+		return ClientFunc(func(req *http.Request) (*http.Response, error) {
+			method, host := req.Method, req.URL.Host
+			start := time.Now()
+			response, err := traceCall(next, req, func(t *timings, response *http.Response, err error) {
+				for _, p := range t.phases() {
+					metrics.ObserveUpstreamPhase(host, p.name, p.duration)
+				}
+				if connected, reused := t.connection(); connected {
+					metrics.ObserveUpstreamConnection(host, reused)
+				}
+			})
+			metrics.ObserveUpstreamRequest(host, method, response, time.Since(start))
+			return response, err
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package restclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/jebo87/golang-microservices/src/api/utils/request_id"
+	"github.com/stretchr/testify/assert"
+)
+
+func record(name string, calls *[]string) Interceptor {
+	return func(next HTTPClient) HTTPClient {
+		return ClientFunc(func(req *http.Request) (*http.Response, error) {
+			*calls = append(*calls, name)
+			return next.Do(req)
+		})
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	calls := []string{}
+	client := Chain(ClientFunc(func(req *http.Request) (*http.Response, error) {
+		calls = append(calls, "client")
+		return status(http.StatusOK)(req)
+	}), record("first", &calls), record("second", &calls))
+
+	client.Do(&http.Request{})
+	assert.EqualValues(t, []string{"first", "second", "client"}, calls)
+}
+
+func TestDefaultInterceptors(t *testing.T) {
+	sent := useResponses(t, fastRetries, status(http.StatusOK))
+	ctx := request_id.NewContext(context.Background(), "req-1")
+
+	response, err := Get(ctx, "https://api.github.com/user", nil)
+	assert.Nil(t, err)
+	response.Body.Close()
+	assert.EqualValues(t, DefaultUserAgent, (*sent)[0].Header.Get("User-Agent"))
+	assert.EqualValues(t, "req-1", (*sent)[0].Header.Get(request_id.Header))
+}
+
+func TestRestClientInterceptors(t *testing.T) {
+	sent := useResponses(t, fastRetries, status(http.StatusOK), status(http.StatusOK), status(http.StatusOK))
+	calls := []string{}
+	client := New(UserAgent("provider/1.0"), record("client", &calls))
+
+	response, err := client.Get(context.Background(), "https://api.github.com/user", nil, WithInterceptors(record("call", &calls)))
+	assert.Nil(t, err)
+	response.Body.Close()
+	assert.EqualValues(t, []string{"client", "call"}, calls)
+	assert.EqualValues(t, "provider/1.0", (*sent)[0].Header.Get("User-Agent"))
+
+	//the package functions don't use the interceptors of the client
+	response, err = Get(context.Background(), "https://api.github.com/user", nil)
+	assert.Nil(t, err)
+	response.Body.Close()
+	assert.EqualValues(t, []string{"client", "call"}, calls)
+	assert.EqualValues(t, DefaultUserAgent, (*sent)[1].Header.Get("User-Agent"))
+}
+
+func TestAuth(t *testing.T) {
+	sent := useResponses(t, fastRetries, status(http.StatusOK), status(http.StatusOK), status(http.StatusOK), status(http.StatusOK))
+	client := New(Auth("token", TokenFromContext))
+
+	client.Get(ContextWithToken(context.Background(), "abc123"), "https://api.github.com/user", nil)
+	assert.EqualValues(t, "token abc123", (*sent)[0].Header.Get("Authorization"))
+
+	//no token, no credentials
+	client.Get(context.Background(), "https://api.github.com/user", nil)
+	assert.EqualValues(t, "", (*sent)[1].Header.Get("Authorization"))
+
+	//the header given by the caller is kept
+	client.Get(ContextWithToken(context.Background(), "abc123"), "https://api.github.com/user", http.Header{"Authorization": {"Bearer xyz"}})
+	assert.EqualValues(t, "Bearer xyz", (*sent)[2].Header.Get("Authorization"))
+
+	Get(context.Background(), "https://api.github.com/user", nil, WithInterceptors(Auth("Bearer", StaticToken("static"))))
+	assert.EqualValues(t, "Bearer static", (*sent)[3].Header.Get("Authorization"))
+}
+
+func TestAuthError(t *testing.T) {
+	sent := useResponses(t, fastRetries)
+	failing := func(context.Context) (string, error) {
+		return "", errors.New("no token available")
+	}
+
+	response, err := Get(context.Background(), "https://api.github.com/user", nil, WithMaxAttempts(1), WithInterceptors(Auth("token", failing)))
+	assert.Nil(t, response)
+	assert.EqualValues(t, "no token available", err.Error())
+	assert.EqualValues(t, 0, len(*sent))
+}
+
+func TestCacheKeyedByInterceptorToken(t *testing.T) {
+	store := useCache(t, DefaultCacheSettings, 10)
+	sent := useResponses(t, fastRetries,
+		respond(http.StatusOK, "first", "ETag", `"v1"`),
+		respond(http.StatusOK, "second", "ETag", `"v2"`))
+	client := New(Auth("token", TokenFromContext))
+
+	response, _ := client.Get(ContextWithToken(context.Background(), "a"), "https://api.github.com/user", nil)
+	readBody(t, response)
+	response, _ = client.Get(ContextWithToken(context.Background(), "b"), "https://api.github.com/user", nil)
+	readBody(t, response)
+
+	assert.EqualValues(t, "", (*sent)[1].Header.Get("If-None-Match"))
+	assert.EqualValues(t, 2, store.Len())
+}
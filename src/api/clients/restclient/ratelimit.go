@@ -0,0 +1,264 @@
+package restclient
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/log"
+	"github.com/jebo87/golang-microservices/src/api/metrics"
+)
+
+const (
+	headerRateLimitRemaining = "X-RateLimit-Remaining"
+	headerRateLimitReset     = "X-RateLimit-Reset"
+
+	//secondaryLimitWait is used when a 429 tells neither Retry-After nor
+	//X-RateLimit-Reset, github asks to wait at least a minute.
+	secondaryLimitWait = time.Minute
+)
+
+//ErrRateLimited is matched, with errors.Is, by the *RateLimitError returned
+//when the quota of a host is exhausted and the call is not sent.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+//RateLimitError tells when the quota of Host is expected to be available again.
+type RateLimitError struct {
+	Host    string
+	RetryAt time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit of %s exceeded until %s", e.Host, e.RetryAt.UTC().Format(time.RFC3339))
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+//RateLimitSettings configures the token bucket kept for every host and
+//credential, as the quotas of github are counted for every token. Calls
+//are paced at RequestsPerSecond with bursts of Burst calls. The bucket
+//follows the X-RateLimit-Remaining and X-RateLimit-Reset headers: once fewer
+//than Burst calls remain, the rate is lowered to spread them until the reset.
+//When the quota is exhausted, or a secondary limit is hit, calls wait for the
+//reset when Wait is set and the reset is at most MaxWait away, or fail with a
+//*RateLimitError otherwise.
+type RateLimitSettings struct {
+	Enabled           bool
+	RequestsPerSecond float64
+	Burst             int
+	Wait              bool
+	MaxWait           time.Duration
+}
+
+var (
+	DefaultRateLimitSettings = RateLimitSettings{
+		Enabled:           true,
+		RequestsPerSecond: 10,
+		Burst:             20,
+		MaxWait:           time.Minute,
+	}
+
+	rateLimitSettings atomic.Value
+
+	//maxLimiters bounds the limiters kept, the least recently used are
+	//dropped as the callers can send any number of tokens.
+	maxLimiters = 10000
+)
+
+func init() {
+	rateLimitSettings.Store(DefaultRateLimitSettings)
+}
+
+//SetRateLimitSettings changes the settings of every rate limiter.
+func SetRateLimitSettings(settings RateLimitSettings) {
+	rateLimitSettings.Store(settings)
+}
+
+//GetRateLimitSettings returns the settings of the rate limiters.
+func GetRateLimitSettings() RateLimitSettings {
+	return rateLimitSettings.Load().(RateLimitSettings)
+}
+
+//ResetRateLimiters forgets the quota of every host and credential.
+func ResetRateLimiters() {
+	shared.limitersMutex.Lock()
+	defer shared.limitersMutex.Unlock()
+	shared.limiters = make(map[string]*list.Element)
+	shared.limitersOrder = list.New()
+}
+
+//WithRateLimitKey makes a request use the limiter of key instead of the one
+//of its credential, e.g. for credentials that change on every call.
+func WithRateLimitKey(key string) Option {
+	return func(o *requestOptions) {
+		o.rateLimitKey = key
+	}
+}
+
+//credential is the Authorization header given to a call or, as the Auth
+//interceptor sets it later, the token of ContextWithToken.
+func credential(ctx context.Context, headers http.Header) string {
+	if authorization := headers.Get(headerAuthorization); authorization != "" {
+		return authorization
+	}
+	token, _ := TokenFromContext(ctx)
+	return token
+}
+
+//limiterFor returns the limiter of the calls to host with credential, it is
+//hashed so the limiters never hold the tokens.
+func (s *state) limiterFor(host string, credential string) *limiter {
+	key := host
+	if credential != "" {
+		sum := sha256.Sum256([]byte(credential))
+		key += " " + hex.EncodeToString(sum[:])
+	}
+	s.limitersMutex.Lock()
+	defer s.limitersMutex.Unlock()
+	if element, ok := s.limiters[key]; ok {
+		s.limitersOrder.MoveToFront(element)
+		return element.Value.(*limiter)
+	}
+	settings := GetRateLimitSettings()
+	l := &limiter{key: key, host: host, tokens: float64(settings.Burst), last: now(), remaining: -1}
+	s.limiters[key] = s.limitersOrder.PushFront(l)
+	for s.limitersOrder.Len() > maxLimiters {
+		oldest := s.limitersOrder.Back()
+		s.limitersOrder.Remove(oldest)
+		delete(s.limiters, oldest.Value.(*limiter).key)
+	}
+	return l
+}
+
+type limiter struct {
+	mutex        sync.Mutex
+	key          string
+	host         string
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+	//remaining and reset are the last values sent by the host, remaining is
+	//-1 until the host sends them.
+	remaining int
+	reset     time.Time
+}
+
+//reserve takes a token and returns how long to wait before sending the call.
+func (l *limiter) reserve(settings RateLimitSettings) (time.Duration, error) {
+	if !settings.Enabled {
+		return 0, nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	current := now()
+	start := current
+	if current.Before(l.blockedUntil) {
+		if !settings.Wait || l.blockedUntil.Sub(current) > settings.MaxWait {
+			return 0, &RateLimitError{Host: l.host, RetryAt: l.blockedUntil}
+		}
+		start = l.blockedUntil
+	}
+
+	rate := l.rate(settings, start)
+	if start.After(l.last) {
+		l.tokens = math.Min(float64(settings.Burst), l.tokens+start.Sub(l.last).Seconds()*rate)
+		l.last = start
+	}
+	wait := start.Sub(current)
+	if l.tokens >= 1 {
+		l.tokens--
+		return wait, nil
+	}
+	if rate <= 0 {
+		return 0, &RateLimitError{Host: l.host, RetryAt: l.reset}
+	}
+	//the token is taken ahead, later calls wait behind this one
+	l.tokens--
+	return wait + time.Duration(-l.tokens/rate*float64(time.Second)), nil
+}
+
+//throttle waits for a token of limiter. It fails when the quota is exhausted
+//and can't be waited for, or when ctx is done before the token is available.
+func throttle(ctx context.Context, l *limiter, method string) error {
+	wait, err := l.reserve(GetRateLimitSettings())
+	if err == nil && exceedsDeadline(ctx, wait) {
+		err = &RateLimitError{Host: l.host, RetryAt: now().Add(wait)}
+	}
+	if err != nil {
+		metrics.ObserveUpstreamThrottled(l.host, metrics.ThrottleRejected)
+		log.WarnContext(ctx, "call rejected by the rate limiter", log.String("method", method), log.String("host", l.host), log.String("error", err.Error()))
+		return err
+	}
+	if wait <= 0 {
+		return nil
+	}
+	metrics.ObserveUpstreamThrottled(l.host, metrics.ThrottleDelayed)
+	log.DebugContext(ctx, "call delayed by the rate limiter", log.String("method", method), log.String("host", l.host), log.Duration("wait", wait))
+	if !sleep(ctx, wait) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+//rate must be called holding the mutex.
+func (l *limiter) rate(settings RateLimitSettings, current time.Time) float64 {
+	rate := settings.RequestsPerSecond
+	if l.remaining >= 0 && l.remaining < settings.Burst && l.reset.After(current) {
+		rate = math.Min(rate, float64(l.remaining)/l.reset.Sub(current).Seconds())
+	}
+	return rate
+}
+
+//update reads the quota left from the response headers.
+func (l *limiter) update(settings RateLimitSettings, response *http.Response) {
+	if !settings.Enabled || response == nil {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	current := now()
+	remaining, remainingErr := strconv.Atoi(response.Header.Get(headerRateLimitRemaining))
+	reset, resetErr := strconv.ParseInt(response.Header.Get(headerRateLimitReset), 10, 64)
+	if remainingErr == nil && resetErr == nil {
+		l.remaining = remaining
+		l.reset = time.Unix(reset, 0)
+		//calls already counted by the host can't be sent again
+		l.tokens = math.Min(l.tokens, float64(remaining))
+		if remaining == 0 && l.reset.After(current) {
+			l.block(l.reset)
+		}
+	}
+
+	if response.StatusCode != http.StatusForbidden && response.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+	//secondary limits
+	if after, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil && after >= 0 {
+		l.block(current.Add(time.Duration(after) * time.Second))
+	} else if response.StatusCode == http.StatusTooManyRequests && !current.Before(l.blockedUntil) {
+		l.block(current.Add(secondaryLimitWait))
+	}
+}
+
+//block must be called holding the mutex. A single call is let through at
+//until, it tells the new quota.
+func (l *limiter) block(until time.Time) {
+	if until.After(l.blockedUntil) {
+		l.blockedUntil = until
+	}
+	l.tokens = 1
+	l.last = l.blockedUntil
+}
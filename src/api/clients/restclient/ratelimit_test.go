@@ -0,0 +1,189 @@
+package restclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func useRateLimitSettings(t *testing.T, settings RateLimitSettings) *time.Time {
+	previous := GetRateLimitSettings()
+	clock := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	SetRateLimitSettings(settings)
+	ResetRateLimiters()
+	t.Cleanup(func() {
+		now = time.Now
+		SetRateLimitSettings(previous)
+		ResetRateLimiters()
+	})
+	return &clock
+}
+
+func quota(status int, remaining int, reset time.Time) *http.Response {
+	return &http.Response{StatusCode: status, Header: http.Header{
+		"X-Ratelimit-Remaining": {strconv.Itoa(remaining)},
+		"X-Ratelimit-Reset":     {strconv.FormatInt(reset.Unix(), 10)},
+	}}
+}
+
+func TestRateLimitPacesCalls(t *testing.T) {
+	settings := RateLimitSettings{Enabled: true, RequestsPerSecond: 2, Burst: 2, MaxWait: time.Minute}
+	clock := useRateLimitSettings(t, settings)
+	l := shared.limiterFor("api.github.com", "")
+
+	for _, expected := range []time.Duration{0, 0, 500 * time.Millisecond, time.Second} {
+		wait, err := l.reserve(settings)
+		assert.Nil(t, err)
+		assert.EqualValues(t, expected, wait)
+	}
+	*clock = clock.Add(10 * time.Second)
+	wait, _ := l.reserve(settings)
+	assert.EqualValues(t, 0, wait)
+}
+
+func TestRateLimitFollowsHeaders(t *testing.T) {
+	settings := RateLimitSettings{Enabled: true, RequestsPerSecond: 10, Burst: 20, MaxWait: time.Minute}
+	clock := useRateLimitSettings(t, settings)
+	l := shared.limiterFor("api.github.com", "")
+
+	//5 calls left for the next 10 seconds: one call every 2 seconds
+	l.update(settings, quota(http.StatusCreated, 5, clock.Add(10*time.Second)))
+	var waits []time.Duration
+	for i := 0; i < 7; i++ {
+		wait, err := l.reserve(settings)
+		assert.Nil(t, err)
+		waits = append(waits, wait)
+	}
+	assert.EqualValues(t, []time.Duration{0, 0, 0, 0, 0, 2 * time.Second, 4 * time.Second}, waits)
+}
+
+func TestRateLimitExhausted(t *testing.T) {
+	settings := RateLimitSettings{Enabled: true, RequestsPerSecond: 10, Burst: 20, MaxWait: time.Minute}
+	clock := useRateLimitSettings(t, settings)
+	l := shared.limiterFor("api.github.com", "")
+	reset := clock.Add(30 * time.Second)
+	l.update(settings, quota(http.StatusForbidden, 0, reset))
+
+	_, err := l.reserve(settings)
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	assert.True(t, reset.Equal(err.(*RateLimitError).RetryAt))
+	assert.EqualValues(t, "rate limit of api.github.com exceeded until 2021-01-01T00:00:30Z", err.Error())
+
+	settings.Wait = true
+	wait, err := l.reserve(settings)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 30*time.Second, wait)
+
+	//the reset is further than MaxWait
+	settings.MaxWait = 10 * time.Second
+	_, err = l.reserve(settings)
+	assert.True(t, errors.Is(err, ErrRateLimited))
+
+	*clock = reset
+	wait, err = l.reserve(settings)
+	assert.Nil(t, err)
+	assert.True(t, wait > 0, "calls queued behind the first one after the reset are paced")
+}
+
+func TestRateLimitSecondaryLimits(t *testing.T) {
+	settings := RateLimitSettings{Enabled: true, RequestsPerSecond: 10, Burst: 20, MaxWait: time.Minute}
+	clock := useRateLimitSettings(t, settings)
+
+	l := shared.limiterFor("a.example.com", "")
+	l.update(settings, &http.Response{StatusCode: http.StatusForbidden, Header: http.Header{"Retry-After": {"30"}}})
+	_, err := l.reserve(settings)
+	assert.EqualValues(t, clock.Add(30*time.Second), err.(*RateLimitError).RetryAt)
+
+	l = shared.limiterFor("b.example.com", "")
+	l.update(settings, &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}})
+	_, err = l.reserve(settings)
+	assert.EqualValues(t, clock.Add(time.Minute), err.(*RateLimitError).RetryAt)
+
+	//a 403 without rate limit headers is a permission error
+	l = shared.limiterFor("c.example.com", "")
+	l.update(settings, &http.Response{StatusCode: http.StatusForbidden, Header: http.Header{}})
+	_, err = l.reserve(settings)
+	assert.Nil(t, err)
+}
+
+func TestRateLimitFailsFastOnceExhausted(t *testing.T) {
+	useRateLimitSettings(t, RateLimitSettings{Enabled: true, RequestsPerSecond: 10, Burst: 20, MaxWait: time.Minute})
+	reset := time.Now().Add(time.Hour)
+	sent := useResponses(t, fastRetries, func(req *http.Request) (*http.Response, error) {
+		return quota(http.StatusForbidden, 0, reset), nil
+	})
+
+	response, err := Get(context.Background(), "https://api.github.com/repos/a/b", nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusForbidden, response.StatusCode)
+
+	response, err = Get(context.Background(), "https://api.github.com/repos/a/b", nil)
+	assert.Nil(t, response)
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	assert.EqualValues(t, 1, len(*sent))
+}
+
+func TestRateLimitIsKeptForEveryToken(t *testing.T) {
+	useRateLimitSettings(t, RateLimitSettings{Enabled: true, RequestsPerSecond: 10, Burst: 20, MaxWait: time.Minute})
+	reset := time.Now().Add(time.Hour)
+	sent := useResponses(t, fastRetries, func(req *http.Request) (*http.Response, error) {
+		return quota(http.StatusForbidden, 0, reset), nil
+	}, status(http.StatusOK), status(http.StatusOK))
+	client := New(Auth("token", TokenFromContext))
+	exhausted := ContextWithToken(context.Background(), "exhausted")
+
+	_, err := client.Get(exhausted, "https://api.github.com/repos/a/b", nil)
+	assert.Nil(t, err)
+	_, err = client.Get(exhausted, "https://api.github.com/repos/a/b", nil)
+	assert.True(t, errors.Is(err, ErrRateLimited))
+
+	response, err := client.Get(ContextWithToken(context.Background(), "other"), "https://api.github.com/repos/a/b", nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, response.StatusCode)
+	response, err = Get(context.Background(), "https://api.github.com/repos/a/b", http.Header{"Authorization": {"token another"}})
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, response.StatusCode)
+	assert.EqualValues(t, 3, len(*sent))
+}
+
+func TestRateLimitersAreBounded(t *testing.T) {
+	useRateLimitSettings(t, RateLimitSettings{Enabled: true, RequestsPerSecond: 10, Burst: 20, MaxWait: time.Minute})
+	previous := maxLimiters
+	maxLimiters = 10
+	defer func() { maxLimiters = previous }()
+	responses := make([]func(*http.Request) (*http.Response, error), 100)
+	for i := range responses {
+		responses[i] = status(http.StatusOK)
+	}
+	sent := useResponses(t, RetryPolicy{MaxAttempts: 1}, responses...)
+
+	for i := 0; i < 100; i++ {
+		headers := http.Header{"Authorization": {"token random-" + strconv.Itoa(i)}}
+		Get(context.Background(), "https://api.github.com/repos/a/b", headers)
+	}
+	assert.EqualValues(t, 100, len(*sent))
+	assert.EqualValues(t, 10, len(shared.limiters))
+	assert.EqualValues(t, 10, shared.limitersOrder.Len())
+
+	//the most recent limiters are kept with their quota, the others start over
+	assert.EqualValues(t, 19, shared.limiterFor("api.github.com", "token random-99").tokens)
+	assert.EqualValues(t, 20, shared.limiterFor("api.github.com", "token random-0").tokens)
+	assert.EqualValues(t, 10, len(shared.limiters))
+}
+
+func TestRateLimitKeyReplacesTheCredential(t *testing.T) {
+	useRateLimitSettings(t, RateLimitSettings{Enabled: true, RequestsPerSecond: 10, Burst: 20, MaxWait: time.Minute})
+	useResponses(t, RetryPolicy{MaxAttempts: 1}, status(http.StatusCreated), status(http.StatusCreated), status(http.StatusCreated), status(http.StatusCreated), status(http.StatusCreated))
+
+	for i := 0; i < 5; i++ {
+		headers := http.Header{"Authorization": {"Bearer jwt-" + strconv.Itoa(i)}}
+		Post(context.Background(), "https://api.github.com/app/installations/1/access_tokens", nil, headers, WithRateLimitKey("github app 7"))
+	}
+	assert.EqualValues(t, 1, len(shared.limiters))
+}
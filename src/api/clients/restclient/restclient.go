@@ -1,17 +1,33 @@
 package restclient
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	neturl "net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/log"
+	"github.com/jebo87/golang-microservices/src/api/tracing"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
+	mocksMutex   sync.RWMutex
 	enabledMocks = false
 	mocks        = make(map[string]*Mock)
 	Client       HTTPClient
+
+	//timeout applied to every request, stored as nanoseconds so it can be
+	//changed while requests are running.
+	timeout int64
 )
 
 type Mock struct {
@@ -22,56 +38,254 @@ type Mock struct {
 }
 
 func init() {
-	Client = &http.Client{}
+	//the default settings can't fail, the app replaces the client with one
+	//built from the configuration
+	Client, _ = NewHTTPClient(DefaultTransportSettings)
 }
 
 type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
+type clientKey struct{}
+
+//ContextWithClient makes the calls made with the returned context use client
+//instead of Client, e.g. a mocks.Transport owned by a single test. Those calls
+//share their own circuit breakers, rate limiters and cache, the calls of other
+//contexts don't affect them.
+func ContextWithClient(ctx context.Context, client HTTPClient) context.Context {
+	return context.WithValue(ctx, clientKey{}, scopedClient{client: client, state: newState(NewLRUCache(DefaultCacheEntries))})
+}
+
+func clientFromContext(ctx context.Context) HTTPClient {
+	if scoped, ok := ctx.Value(clientKey{}).(scopedClient); ok {
+		return scoped.client
+	}
+	return Client
+}
+
+//SetTimeout changes the timeout applied to every request. Zero disables it.
+func SetTimeout(d time.Duration) {
+	atomic.StoreInt64(&timeout, int64(d))
+}
+
+func requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d := time.Duration(atomic.LoadInt64(&timeout)); d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
+
+//cancelOnClose releases the request context once the body has been consumed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
 func getMockId(httpMethod string, url string) string {
 	return fmt.Sprintf("%s_%s", httpMethod, url)
 }
 
-func Post(url string, body interface{}, headers http.Header) (*http.Response, error) {
+//Get sends a GET request to url.
+func Get(ctx context.Context, url string, headers http.Header, options ...Option) (*http.Response, error) {
+	return do(ctx, http.MethodGet, url, nil, headers, options)
+}
+
+//Post sends body as json to url, or as it is when body is a Body or a
+//*Multipart. The X-Request-ID stored in ctx, if any, is forwarded so the call
+//can be tied to the request that triggered it, see RequestID.
+func Post(ctx context.Context, url string, body interface{}, headers http.Header, options ...Option) (*http.Response, error) {
+	return do(ctx, http.MethodPost, url, body, headers, options)
+}
+
+//Put sends body to url, see Post.
+func Put(ctx context.Context, url string, body interface{}, headers http.Header, options ...Option) (*http.Response, error) {
+	return do(ctx, http.MethodPut, url, body, headers, options)
+}
+
+//Patch sends body to url, see Post.
+func Patch(ctx context.Context, url string, body interface{}, headers http.Header, options ...Option) (*http.Response, error) {
+	return do(ctx, http.MethodPatch, url, body, headers, options)
+}
+
+//Delete sends a DELETE request to url.
+func Delete(ctx context.Context, url string, headers http.Header, options ...Option) (*http.Response, error) {
+	return do(ctx, http.MethodDelete, url, nil, headers, options)
+}
+
+//do sends the request, retrying it as described in retry.go, and returns once
+//the response headers are read. Every attempt is canceled when ctx is done or
+//the configured timeout expires, so the response body must be closed to release it.
+func do(ctx context.Context, method string, url string, body interface{}, headers http.Header, options []Option) (*http.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	if enabledMocks {
+	if mock, enabled := getMock(method, url); enabled {
 		//return local mock without calling external resourses
-		mock := mocks[getMockId(http.MethodPost, url)]
 		if mock == nil {
 			return nil, errors.New("no mockup given for request")
 		}
 		return mock.Response, mock.Err
 	}
 
-	jsonBytes, err := json.Marshal(body)
+	payload, err := jsonBody(body)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := neturl.Parse(url)
 	if err != nil {
 		return nil, err
 	}
-	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(jsonBytes))
-	request.Header = headers
+	scope := stateFromContext(ctx)
+	breaker := scope.breakerFor(target.Host)
 
-	return Client.Do(request)
+	opts := newOptions(options)
+	rateLimitKey := opts.rateLimitKey
+	if rateLimitKey == "" {
+		rateLimitKey = credential(ctx, headers)
+	}
+	limiter := scope.limiterFor(target.Host, rateLimitKey)
+	policy := GetRetryPolicy()
+	attempts := opts.attempts(method, policy)
+	if payload != nil && payload.once {
+		attempts = 1
+	}
+	for attempt := 1; ; attempt++ {
+		if err := throttle(ctx, limiter, method); err != nil {
+			return nil, err
+		}
+		settings := GetBreakerSettings()
+		if err := breaker.allow(settings); err != nil {
+			log.WarnContext(ctx, "call rejected by the circuit breaker", log.String("method", method), log.String("host", target.Host))
+			return nil, err
+		}
+		response, err := send(ctx, method, url, payload, headers, opts.interceptors)
+		abandoned := err != nil && ctx.Err() != nil
+		breaker.record(settings, !abandoned && (err != nil || response.StatusCode >= http.StatusInternalServerError), abandoned)
+		limiter.update(GetRateLimitSettings(), response)
+
+		if attempt >= attempts || !shouldRetry(ctx, response, err) {
+			return response, err
+		}
+		wait, ok := policy.wait(attempt, response)
+		if !ok || exceedsDeadline(ctx, wait) {
+			return response, err
+		}
+		retrying(ctx, method, target.Host, attempt, wait, response, err)
+		if !sleep(ctx, wait) {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+//send makes a single attempt through the interceptors, see chainFor. payload
+//is nil for requests without a body.
+func send(ctx context.Context, method string, url string, payload *Body, headers http.Header, interceptors []Interceptor) (*http.Response, error) {
+	ctx, span := tracing.Start(ctx, "HTTP "+method, trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	ctx, cancel := requestContext(ctx)
+	request, err := newRequest(ctx, method, url, payload)
+	if err != nil {
+		cancel()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	request.Header = headers.Clone()
+	if request.Header == nil {
+		request.Header = http.Header{}
+	}
+	if payload != nil && payload.ContentType != "" && request.Header.Get("Content-Type") == "" {
+		request.Header.Set("Content-Type", payload.ContentType)
+	}
+	span.SetAttributes(semconv.HTTPClientAttributesFromHTTPRequest(request)...)
+	tracing.Inject(ctx, propagation.HeaderCarrier(request.Header))
+
+	response, err := chainFor(clientFromContext(ctx), interceptors).Do(request)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if response != nil {
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(response.StatusCode)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(response.StatusCode))
+	}
+	if err != nil || response == nil || response.Body == nil {
+		cancel()
+		return response, err
+	}
+	response.Body = &cancelOnClose{ReadCloser: response.Body, cancel: cancel}
+	return response, nil
+}
+
+//newRequest opens payload again for every attempt, and for the redirects
+//of bodies that can be read more than once.
+func newRequest(ctx context.Context, method string, url string, payload *Body) (*http.Request, error) {
+	if payload == nil {
+		return http.NewRequestWithContext(ctx, method, url, nil)
+	}
+	reader, err := payload.open()
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	switch {
+	case payload.Length == 0:
+		reader.Close()
+		request.Body = http.NoBody
+	case payload.Length > 0:
+		request.ContentLength = payload.Length
+	}
+	if !payload.once {
+		request.GetBody = payload.open
+	}
+	return request, nil
+}
 
+func getMock(method string, url string) (*Mock, bool) {
+	mocksMutex.RLock()
+	defer mocksMutex.RUnlock()
+	return mocks[getMockId(method, url)], enabledMocks
 }
 
 func StartMockups() {
+	mocksMutex.Lock()
+	defer mocksMutex.Unlock()
 	enabledMocks = true
 }
 
 func StopMockups() {
+	mocksMutex.Lock()
+	defer mocksMutex.Unlock()
 	enabledMocks = false
 }
 
 func AddMockup(mock Mock) {
+	mocksMutex.Lock()
+	defer mocksMutex.Unlock()
 	mocks[getMockId(mock.HttpMethod, mock.Url)] = &mock
 }
 
 func FlushMockups() {
+	mocksMutex.Lock()
+	defer mocksMutex.Unlock()
 	mocks = make(map[string]*Mock)
 
 }
 
 func GetMocks() map[string]*Mock {
+	mocksMutex.RLock()
+	defer mocksMutex.RUnlock()
 	return mocks
 }
@@ -0,0 +1,140 @@
+package restclient
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	httpmocks "github.com/jebo87/golang-microservices/src/api/utils/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func useServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	server := httptest.NewServer(handler)
+	previous := Client
+	Client = server.Client()
+	t.Cleanup(func() {
+		Client = previous
+		server.Close()
+	})
+	return server
+}
+
+func TestMockupsForEveryVerb(t *testing.T) {
+	StartMockups()
+	defer StopMockups()
+	defer FlushMockups()
+
+	url := "https://api.github.com/repos/owner/repo"
+	calls := map[string]func() (*http.Response, error){
+		http.MethodGet:    func() (*http.Response, error) { return Get(context.Background(), url, nil) },
+		http.MethodPost:   func() (*http.Response, error) { return Post(context.Background(), url, nil, nil) },
+		http.MethodPut:    func() (*http.Response, error) { return Put(context.Background(), url, nil, nil) },
+		http.MethodPatch:  func() (*http.Response, error) { return Patch(context.Background(), url, nil, nil) },
+		http.MethodDelete: func() (*http.Response, error) { return Delete(context.Background(), url, nil) },
+	}
+	for method := range calls {
+		AddMockup(Mock{Url: url, HttpMethod: method, Response: &http.Response{StatusCode: http.StatusOK, Status: method}})
+	}
+
+	for method, call := range calls {
+		response, err := call()
+		assert.Nil(t, err)
+		assert.EqualValues(t, method, response.Status)
+	}
+}
+
+func TestMockupNotFound(t *testing.T) {
+	StartMockups()
+	defer StopMockups()
+	FlushMockups()
+
+	response, err := Delete(context.Background(), "https://api.github.com/repos/owner/repo", nil)
+	assert.Nil(t, response)
+	assert.EqualValues(t, "no mockup given for request", err.Error())
+}
+
+func TestVerbsSendMethodAndBody(t *testing.T) {
+	server := useServer(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Content-Type", r.Header.Get("Content-Type"))
+		w.Write(body)
+	})
+
+	response, err := Patch(context.Background(), server.URL, map[string]string{"name": "x"}, http.Header{"X-Custom": {"1"}})
+	assert.Nil(t, err)
+	body, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	assert.EqualValues(t, http.MethodPatch, response.Header.Get("X-Method"))
+	assert.EqualValues(t, "application/json", response.Header.Get("X-Content-Type"))
+	assert.EqualValues(t, `{"name":"x"}`, string(body))
+
+	response, err = Get(context.Background(), server.URL, nil)
+	assert.Nil(t, err)
+	body, _ = ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	assert.EqualValues(t, http.MethodGet, response.Header.Get("X-Method"))
+	assert.EqualValues(t, "", response.Header.Get("X-Content-Type"))
+	assert.EqualValues(t, "", string(body))
+}
+
+func TestInvalidURL(t *testing.T) {
+	response, err := Get(context.Background(), "://missing-scheme", nil)
+	assert.Nil(t, response)
+	assert.NotNil(t, err)
+}
+
+func TestCanceledContext(t *testing.T) {
+	server := useServer(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the request should not be sent")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	response, err := Put(ctx, server.URL, map[string]string{}, nil)
+	assert.Nil(t, response)
+	assert.EqualValues(t, context.Canceled, err)
+}
+
+func TestDeadline(t *testing.T) {
+	release := make(chan struct{})
+	server := useServer(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	defer close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	response, err := Get(ctx, server.URL, nil)
+	assert.Nil(t, response)
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestContextWithClient(t *testing.T) {
+	for _, name := range []string{"first", "second"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			url := "https://" + name + ".example.com/repos"
+			transport := httpmocks.NewTransport()
+			transport.On(httpmocks.Match(http.MethodPut, url)).Respond(http.StatusOK, name)
+
+			ctx := ContextWithClient(context.Background(), transport)
+			response, err := Put(ctx, url, map[string]string{"name": name}, nil)
+			assert.Nil(t, err)
+			body, _ := ioutil.ReadAll(response.Body)
+			response.Body.Close()
+			assert.EqualValues(t, name, string(body))
+			transport.AssertCalled(t, httpmocks.Match(http.MethodPut, url).Header("Content-Type", "application/json").JSONBody(map[string]string{"name": name}), 1)
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package restclient
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/log"
+	"github.com/jebo87/golang-microservices/src/api/metrics"
+)
+
+//RetryPolicy tells how failed calls are sent again. Calls are retried on
+//connection errors and on 429, 502, 503 and 504 responses, waiting an
+//exponential backoff with jitter between InitialBackoff and MaxBackoff or,
+//on 429 and 503 responses, the Retry-After sent by the server.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+var (
+	DefaultRetryPolicy = RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+	}
+
+	retryPolicy atomic.Value
+)
+
+func init() {
+	retryPolicy.Store(DefaultRetryPolicy)
+}
+
+//SetRetryPolicy changes the policy applied to every request.
+func SetRetryPolicy(policy RetryPolicy) {
+	retryPolicy.Store(policy)
+}
+
+//GetRetryPolicy returns the policy applied to every request.
+func GetRetryPolicy() RetryPolicy {
+	return retryPolicy.Load().(RetryPolicy)
+}
+
+//Option changes how a single request is sent.
+type Option func(o *requestOptions)
+
+type requestOptions struct {
+	maxAttempts   int
+	retryUnsafely bool
+	interceptors  []Interceptor
+	rateLimitKey  string
+}
+
+//WithMaxAttempts overrides RetryPolicy.MaxAttempts for a single request.
+//1 disables the retries.
+func WithMaxAttempts(attempts int) Option {
+	return func(o *requestOptions) {
+		o.maxAttempts = attempts
+	}
+}
+
+//RetryNonIdempotent allows retrying POST and PATCH requests. Only use it
+//when sending the request twice does no harm.
+func RetryNonIdempotent() Option {
+	return func(o *requestOptions) {
+		o.retryUnsafely = true
+	}
+}
+
+func newOptions(options []Option) requestOptions {
+	o := requestOptions{}
+	for _, option := range options {
+		option(&o)
+	}
+	return o
+}
+
+func (o requestOptions) attempts(method string, policy RetryPolicy) int {
+	if !o.retryUnsafely && !isIdempotent(method) {
+		return 1
+	}
+	if o.maxAttempts > 0 {
+		return o.maxAttempts
+	}
+	return policy.MaxAttempts
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func shouldRetry(ctx context.Context, response *http.Response, err error) bool {
+	if err != nil {
+		//errors caused by the caller giving up are final
+		return ctx.Err() == nil
+	}
+	switch response.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+//wait returns the time to wait before the next attempt. It returns false when
+//the server asks to wait longer than MaxBackoff, the response is then returned as is.
+func (p RetryPolicy) wait(attempt int, response *http.Response) (time.Duration, bool) {
+	if after, ok := retryAfter(response); ok {
+		return after, after <= p.MaxBackoff
+	}
+
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0, true
+	}
+	//equal jitter keeps at least half of the backoff while spreading the retries
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(backoff-half)+1)), true
+}
+
+//retryAfter reads the Retry-After header, in seconds or as an http date,
+//of 429 and 503 responses.
+func retryAfter(response *http.Response) (time.Duration, bool) {
+	if response == nil || (response.StatusCode != http.StatusTooManyRequests && response.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+	value := response.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func exceedsDeadline(ctx context.Context, wait time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return ok && time.Now().Add(wait).After(deadline)
+}
+
+//retrying records the failed attempt and releases its response.
+func retrying(ctx context.Context, method string, host string, attempt int, wait time.Duration, response *http.Response, err error) {
+	metrics.ObserveUpstreamRetry(host, method, response)
+
+	fields := []log.Field{
+		log.String("method", method),
+		log.String("host", host),
+		log.Int("attempt", attempt),
+		log.Duration("wait", wait),
+	}
+	if err != nil {
+		fields = append(fields, log.String("error", err.Error()))
+	}
+	if response != nil {
+		fields = append(fields, log.Int("status", response.StatusCode))
+		if response.Body != nil {
+			//draining lets the connection be reused
+			_, _ = io.Copy(ioutil.Discard, io.LimitReader(response.Body, 4096))
+			response.Body.Close()
+		}
+	}
+	log.WarnContext(ctx, "retrying request", fields...)
+}
+
+//sleep waits for d and returns false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,155 @@
+package restclient
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func useResponses(t *testing.T, policy RetryPolicy, responses ...func(req *http.Request) (*http.Response, error)) *[]*http.Request {
+	previousClient := Client
+	previousPolicy := GetRetryPolicy()
+	t.Cleanup(func() {
+		Client = previousClient
+		SetRetryPolicy(previousPolicy)
+	})
+
+	SetRetryPolicy(policy)
+	ResetBreakers()
+	ResetRateLimiters()
+	sent := &[]*http.Request{}
+	Client = ClientFunc(func(req *http.Request) (*http.Response, error) {
+		next := responses[len(*sent)]
+		*sent = append(*sent, req)
+		return next(req)
+	})
+	return sent
+}
+
+func status(code int, headers ...string) func(*http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		response := &http.Response{StatusCode: code, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader("body"))}
+		for i := 0; i+1 < len(headers); i += 2 {
+			response.Header.Set(headers[i], headers[i+1])
+		}
+		return response, nil
+	}
+}
+
+func failure(req *http.Request) (*http.Response, error) {
+	return nil, errors.New("connection reset by peer")
+}
+
+var fastRetries = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+
+func TestRetryTransientFailures(t *testing.T) {
+	sent := useResponses(t, fastRetries, failure, status(http.StatusBadGateway), status(http.StatusOK))
+
+	response, err := Get(context.Background(), "https://retry.example.com/repos", nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, response.StatusCode)
+	assert.EqualValues(t, 3, len(*sent))
+
+	scraped := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(scraped, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, scraped.Body.String(), `api_upstream_retries_total{host="retry.example.com",method="GET",status="502"} 1`)
+	assert.Contains(t, scraped.Body.String(), `api_upstream_retries_total{host="retry.example.com",method="GET",status="error"} 1`)
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	sent := useResponses(t, fastRetries, status(http.StatusBadGateway), status(http.StatusBadGateway), status(http.StatusGatewayTimeout))
+
+	response, err := Delete(context.Background(), "https://api.github.com/repos/a/b", nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusGatewayTimeout, response.StatusCode)
+	assert.EqualValues(t, 3, len(*sent))
+}
+
+func TestNoRetryOnClientErrors(t *testing.T) {
+	sent := useResponses(t, fastRetries, status(http.StatusNotFound))
+
+	response, err := Get(context.Background(), "https://api.github.com/repos/a/b", nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusNotFound, response.StatusCode)
+	assert.EqualValues(t, 1, len(*sent))
+}
+
+func TestNonIdempotentRequiresOptIn(t *testing.T) {
+	sent := useResponses(t, fastRetries, status(http.StatusBadGateway))
+	response, err := Post(context.Background(), "https://api.github.com/user/repos", map[string]string{"name": "x"}, nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusBadGateway, response.StatusCode)
+	assert.EqualValues(t, 1, len(*sent))
+
+	sent = useResponses(t, fastRetries, status(http.StatusBadGateway), status(http.StatusCreated))
+	response, err = Post(context.Background(), "https://api.github.com/user/repos", map[string]string{"name": "x"}, nil, RetryNonIdempotent())
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusCreated, response.StatusCode)
+	assert.EqualValues(t, 2, len(*sent))
+	//every attempt sends the whole body
+	for _, req := range *sent {
+		body, _ := ioutil.ReadAll(req.Body)
+		assert.EqualValues(t, `{"name":"x"}`, string(body))
+	}
+}
+
+func TestWithMaxAttempts(t *testing.T) {
+	sent := useResponses(t, fastRetries, failure)
+
+	response, err := Get(context.Background(), "https://api.github.com/repos/a/b", nil, WithMaxAttempts(1))
+	assert.Nil(t, response)
+	assert.EqualValues(t, "connection reset by peer", err.Error())
+	assert.EqualValues(t, 1, len(*sent))
+}
+
+func TestRetryAfter(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Second}
+	sent := useResponses(t, policy, status(http.StatusTooManyRequests, "Retry-After", "1"), status(http.StatusOK))
+
+	start := time.Now()
+	response, err := Get(context.Background(), "https://api.github.com/repos/a/b", nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, response.StatusCode)
+	assert.EqualValues(t, 2, len(*sent))
+	assert.True(t, time.Since(start) >= time.Second)
+}
+
+func TestRetryAfterLongerThanMaxBackoff(t *testing.T) {
+	sent := useResponses(t, fastRetries, status(http.StatusServiceUnavailable, "Retry-After", "120"))
+
+	response, err := Get(context.Background(), "https://api.github.com/repos/a/b", nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusServiceUnavailable, response.StatusCode)
+	assert.EqualValues(t, 1, len(*sent))
+}
+
+func TestRetryStopsWhenContextIsDone(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: time.Second}
+	ctx, cancel := context.WithCancel(context.Background())
+	sent := useResponses(t, policy, func(req *http.Request) (*http.Response, error) {
+		time.AfterFunc(10*time.Millisecond, cancel)
+		return status(http.StatusBadGateway)(req)
+	})
+
+	response, err := Get(ctx, "https://api.github.com/repos/a/b", nil)
+	assert.Nil(t, response)
+	assert.EqualValues(t, context.Canceled, err)
+	assert.EqualValues(t, 1, len(*sent))
+}
+
+func TestBackoffGrowsAndIsCapped(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, max := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 8: time.Second} {
+		wait, ok := policy.wait(attempt, nil)
+		assert.True(t, ok)
+		assert.True(t, wait >= max/2 && wait <= max, "attempt %d waited %s", attempt, wait)
+	}
+}
@@ -0,0 +1,56 @@
+package restclient
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+//state is what restclient learns from the calls it sends: the circuit breaker
+//of every host, the rate limiter of every host and credential, and the cached
+//responses. The calls sent with Client share the package state, the ones sent
+//with a client given to ContextWithClient have their own, so the tests owning
+//those clients can run in parallel.
+type state struct {
+	breakersMutex sync.Mutex
+	breakers      map[string]*breaker
+
+	limitersMutex sync.Mutex
+	limiters      map[string]*list.Element
+	limitersOrder *list.List
+
+	//cache is nil for the package state, which uses GetCacheStore.
+	cache CacheStore
+}
+
+//shared is the state of the calls sent with Client.
+var shared = newState(nil)
+
+func newState(cache CacheStore) *state {
+	return &state{
+		breakers:      make(map[string]*breaker),
+		limiters:      make(map[string]*list.Element),
+		limitersOrder: list.New(),
+		cache:         cache,
+	}
+}
+
+//scopedClient is the client given to ContextWithClient, with its own state.
+type scopedClient struct {
+	client HTTPClient
+	state  *state
+}
+
+func stateFromContext(ctx context.Context) *state {
+	if scoped, ok := ctx.Value(clientKey{}).(scopedClient); ok {
+		return scoped.state
+	}
+	return shared
+}
+
+func (s *state) cacheStore() CacheStore {
+	if s.cache != nil {
+		return s.cache
+	}
+	return GetCacheStore()
+}
@@ -0,0 +1,128 @@
+package restclient
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/metrics"
+)
+
+//timings collects, through httptrace, when every phase of an attempt
+//started and ended. Phases not gone through, e.g. dns and connect on a
+//reused connection, stay zero.
+type timings struct {
+	mutex        sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	firstByte    time.Time
+	end          time.Time
+	connected    bool
+	reused       bool
+}
+
+type phase struct {
+	name     string
+	duration time.Duration
+}
+
+func (t *timings) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.mark(&t.dnsDone) },
+		//with several addresses connections are attempted in parallel, the
+		//first one established is kept
+		ConnectStart: func(string, string) { t.mark(&t.connectStart) },
+		ConnectDone: func(network string, addr string, err error) {
+			if err == nil {
+				t.mark(&t.connectDone)
+			}
+		},
+		TLSHandshakeStart: func() { t.mark(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { t.mark(&t.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			t.connected, t.reused = true, info.Reused
+		},
+		GotFirstResponseByte: func() { t.mark(&t.firstByte) },
+	}
+}
+
+//mark keeps the first time an event happened.
+func (t *timings) mark(at *time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if at.IsZero() {
+		*at = time.Now()
+	}
+}
+
+//phases returns the duration of the phases gone through, total last.
+func (t *timings) phases() []phase {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var phases []phase
+	for _, p := range []struct {
+		name  string
+		start time.Time
+		end   time.Time
+	}{
+		{metrics.PhaseDNS, t.dnsStart, t.dnsDone},
+		{metrics.PhaseConnect, t.connectStart, t.connectDone},
+		{metrics.PhaseTLS, t.tlsStart, t.tlsDone},
+		{metrics.PhaseFirstByte, t.start, t.firstByte},
+		{metrics.PhaseTotal, t.start, t.end},
+	} {
+		if !p.start.IsZero() && !p.end.IsZero() {
+			phases = append(phases, phase{name: p.name, duration: p.end.Sub(p.start)})
+		}
+	}
+	return phases
+}
+
+//connection tells whether a connection was used and if it came from the pool.
+func (t *timings) connection() (connected bool, reused bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.connected, t.reused
+}
+
+//traceCall sends req with next, collecting its timings, and calls done once
+//the call is over: when its body is closed or when it failed.
+func traceCall(next HTTPClient, req *http.Request, done func(t *timings, response *http.Response, err error)) (*http.Response, error) {
+	t := &timings{start: time.Now()}
+	response, err := next.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), t.clientTrace())))
+	if err != nil || response == nil || response.Body == nil {
+		t.mark(&t.end)
+		done(t, response, err)
+		return response, err
+	}
+	var once sync.Once
+	response.Body = &closeHook{ReadCloser: response.Body, hook: func() {
+		once.Do(func() {
+			t.mark(&t.end)
+			done(t, response, nil)
+		})
+	}}
+	return response, nil
+}
+
+//closeHook runs hook once the body is closed.
+type closeHook struct {
+	io.ReadCloser
+	hook func()
+}
+
+func (b *closeHook) Close() error {
+	defer b.hook()
+	return b.ReadCloser.Close()
+}
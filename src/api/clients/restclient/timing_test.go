@@ -0,0 +1,86 @@
+package restclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/log"
+	"github.com/jebo87/golang-microservices/src/api/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func captureTimings(t *testing.T) *[]map[string]interface{} {
+	entries := &[]map[string]interface{}{}
+	writeCallLog = func(ctx context.Context, msg string, fields ...log.Field) {
+		entry := make(map[string]interface{})
+		for _, f := range fields {
+			entry[f.Key] = f.Value
+		}
+		*entries = append(*entries, entry)
+	}
+	t.Cleanup(func() {
+		writeCallLog = log.InfoContext
+	})
+	return entries
+}
+
+func TestTimings(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	previous := Client
+	Client = server.Client()
+	defer func() { Client = previous }()
+	ResetRateLimiters()
+	entries := captureTimings(t)
+
+	for i := 0; i < 2; i++ {
+		response, err := Get(context.Background(), server.URL+"/repos", nil)
+		assert.Nil(t, err)
+		assert.EqualValues(t, i, len(*entries), "timings are logged once the body is closed")
+		readBody(t, response)
+		assert.EqualValues(t, i+1, len(*entries))
+	}
+
+	first, second := (*entries)[0], (*entries)[1]
+	host := server.Listener.Addr().String()
+	assert.EqualValues(t, host, first["host"])
+	assert.EqualValues(t, http.StatusOK, first["status"])
+	assert.EqualValues(t, false, first["reused"])
+	for _, phase := range []string{metrics.PhaseConnect, metrics.PhaseTLS, metrics.PhaseFirstByte, metrics.PhaseTotal} {
+		assert.IsType(t, time.Duration(0), first[phase], phase)
+	}
+	//the address is an ip, nothing to resolve
+	assert.NotContains(t, first, metrics.PhaseDNS)
+
+	assert.EqualValues(t, true, second["reused"])
+	assert.NotContains(t, second, metrics.PhaseConnect)
+	assert.NotContains(t, second, metrics.PhaseTLS)
+	assert.Contains(t, second, metrics.PhaseFirstByte)
+
+	scraped := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(scraped, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, scraped.Body.String(), fmt.Sprintf(`api_upstream_connections_total{host="%s",reused="false"} 1`, host))
+	assert.Contains(t, scraped.Body.String(), fmt.Sprintf(`api_upstream_connections_total{host="%s",reused="true"} 1`, host))
+	assert.Contains(t, scraped.Body.String(), fmt.Sprintf(`api_upstream_phase_duration_seconds_count{host="%s",phase="tls"} 1`, host))
+	assert.Contains(t, scraped.Body.String(), fmt.Sprintf(`api_upstream_phase_duration_seconds_count{host="%s",phase="total"} 2`, host))
+}
+
+func TestTimingsOfFailedCalls(t *testing.T) {
+	useResponses(t, RetryPolicy{MaxAttempts: 1, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}, failure)
+	entries := captureTimings(t)
+
+	_, err := Get(context.Background(), "https://timings.example.com/repos", nil)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, 1, len(*entries))
+	entry := (*entries)[0]
+	assert.EqualValues(t, "connection reset by peer", entry["error"])
+	assert.Contains(t, entry, metrics.PhaseTotal)
+	assert.NotContains(t, entry, "status")
+	assert.NotContains(t, entry, "reused")
+}
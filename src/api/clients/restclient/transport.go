@@ -0,0 +1,125 @@
+package restclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+//TransportSettings configures the http.Client built by NewHTTPClient.
+//Calls go through the HTTP_PROXY, HTTPS_PROXY and NO_PROXY of the
+//environment unless Proxy is set, in which case Proxy is used for every host
+//but those in NoProxy, or in the NO_PROXY of the environment when NoProxy is
+//empty. CAFile is a PEM bundle trusted on top of the system roots.
+type TransportSettings struct {
+	DialTimeout         time.Duration
+	KeepAlive           time.Duration
+	TLSHandshakeTimeout time.Duration
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	HTTP2               bool
+	Proxy               string
+	NoProxy             string
+	CAFile              string
+}
+
+var DefaultTransportSettings = TransportSettings{
+	DialTimeout:         5 * time.Second,
+	KeepAlive:           30 * time.Second,
+	TLSHandshakeTimeout: 5 * time.Second,
+	MaxIdleConnsPerHost: 10,
+	IdleConnTimeout:     90 * time.Second,
+	HTTP2:               true,
+}
+
+//NewHTTPClient returns a client, to be used as Client, sending the calls
+//through a transport built from settings. The overall timeout of every call
+//is the one given to SetTimeout.
+func NewHTTPClient(settings TransportSettings) (*http.Client, error) {
+	transport, err := newTransport(settings)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+func newTransport(settings TransportSettings) (*http.Transport, error) {
+	proxy, err := proxyFunc(settings)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if settings.CAFile != "" {
+		if tlsConfig.RootCAs, err = loadCAs(settings.CAFile); err != nil {
+			return nil, err
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: settings.DialTimeout, KeepAlive: settings.KeepAlive}
+	transport := &http.Transport{
+		Proxy:               proxy,
+		DialContext:         dialer.DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: settings.TLSHandshakeTimeout,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: settings.MaxIdleConnsPerHost,
+		IdleConnTimeout:     settings.IdleConnTimeout,
+		ForceAttemptHTTP2:   settings.HTTP2,
+	}
+	if !settings.HTTP2 {
+		//a non nil empty map disables http2
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return transport, nil
+}
+
+func proxyFunc(settings TransportSettings) (func(*http.Request) (*url.URL, error), error) {
+	if settings.Proxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	if _, err := url.Parse(settings.Proxy); err != nil {
+		return nil, fmt.Errorf("invalid proxy %s: %s", settings.Proxy, err)
+	}
+	noProxy := settings.NoProxy
+	if noProxy == "" {
+		noProxy = getFirstEnv("NO_PROXY", "no_proxy")
+	}
+	proxy := (&httpproxy.Config{HTTPProxy: settings.Proxy, HTTPSProxy: settings.Proxy, NoProxy: noProxy}).ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}, nil
+}
+
+func getFirstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+//loadCAs returns the system roots with the certificates of file added.
+func loadCAs(file string) (*x509.CertPool, error) {
+	bundle, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA bundle %s: %s", file, err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, errors.New("no certificate found in CA bundle " + file)
+	}
+	return pool, nil
+}
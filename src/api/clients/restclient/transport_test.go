@@ -0,0 +1,129 @@
+package restclient
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//writeCA writes the certificate of server to a PEM bundle.
+func writeCA(t *testing.T, server *httptest.Server) string {
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.Nil(t, ioutil.WriteFile(file, bundle, 0600))
+	return file
+}
+
+func useClient(t *testing.T, settings TransportSettings) {
+	client, err := NewHTTPClient(settings)
+	assert.Nil(t, err)
+	previous := Client
+	Client = client
+	ResetRateLimiters()
+	t.Cleanup(func() {
+		Client = previous
+	})
+}
+
+func TestTransportTrustsCAFile(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	useClient(t, DefaultTransportSettings)
+	_, err := Get(context.Background(), server.URL, nil, WithMaxAttempts(1))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "certificate")
+
+	settings := DefaultTransportSettings
+	settings.CAFile = writeCA(t, server)
+	useClient(t, settings)
+	response, err := Get(context.Background(), server.URL, nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "HTTP/2.0", readBody(t, response))
+
+	settings.HTTP2 = false
+	useClient(t, settings)
+	response, err = Get(context.Background(), server.URL, nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "HTTP/1.1", readBody(t, response))
+}
+
+func TestTransportInvalidCAFile(t *testing.T) {
+	_, err := NewHTTPClient(TransportSettings{CAFile: filepath.Join(t.TempDir(), "missing.pem")})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "error reading CA bundle")
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	assert.Nil(t, ioutil.WriteFile(empty, []byte("not a certificate"), 0600))
+	_, err = NewHTTPClient(TransportSettings{CAFile: empty})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no certificate found in CA bundle")
+}
+
+func TestTransportProxy(t *testing.T) {
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied <- r.URL.String()
+		w.Write([]byte("proxied"))
+	}))
+	defer proxy.Close()
+
+	settings := DefaultTransportSettings
+	settings.Proxy = proxy.URL
+	settings.NoProxy = "internal.example.com,.corp.example.com"
+	useClient(t, settings)
+
+	response, err := Get(context.Background(), "http://api.github.example.com/repos", nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "proxied", readBody(t, response))
+	assert.EqualValues(t, "http://api.github.example.com/repos", <-proxied)
+
+	proxyOf, err := proxyFunc(settings)
+	assert.Nil(t, err)
+	for target, expected := range map[string]string{
+		"https://api.github.com/user":           proxy.URL,
+		"https://internal.example.com/user":     "",
+		"https://github.corp.example.com/user":  "",
+		"https://internal.example.com.evil/org": proxy.URL,
+	} {
+		parsed, _ := url.Parse(target)
+		used, err := proxyOf(&http.Request{URL: parsed})
+		assert.Nil(t, err)
+		if expected == "" {
+			assert.Nil(t, used, target)
+		} else {
+			assert.EqualValues(t, expected, used.String(), target)
+		}
+	}
+}
+
+func TestTransportNoProxyFromEnvironment(t *testing.T) {
+	previous, set := os.LookupEnv("NO_PROXY")
+	os.Setenv("NO_PROXY", "ghe.example.com")
+	t.Cleanup(func() {
+		if set {
+			os.Setenv("NO_PROXY", previous)
+		} else {
+			os.Unsetenv("NO_PROXY")
+		}
+	})
+
+	proxyOf, err := proxyFunc(TransportSettings{Proxy: "http://proxy.example.com:3128"})
+	assert.Nil(t, err)
+	parsed, _ := url.Parse("https://ghe.example.com/api/v3")
+	used, err := proxyOf(&http.Request{URL: parsed})
+	assert.Nil(t, err)
+	assert.Nil(t, used)
+}
@@ -0,0 +1,568 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	production = "production"
+
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+
+	TracingExporterNone   = "none"
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+	TracingExporterFile   = "file"
+
+	RateLimitWait = "wait"
+	RateLimitFail = "fail"
+
+	GithubAuthPAT = "pat"
+	GithubAuthApp = "app"
+
+	TokenProviderEnv           = "env"
+	TokenProviderFile          = "file"
+	TokenProviderEncryptedFile = "encrypted_file"
+)
+
+type Config struct {
+	Environment string          `json:"environment" yaml:"environment"`
+	Server      ServerConfig    `json:"server" yaml:"server"`
+	Admin       AdminConfig     `json:"admin" yaml:"admin"`
+	Github      GithubConfig    `json:"github" yaml:"github"`
+	Log         LogConfig       `json:"log" yaml:"log"`
+	Tracing     TracingConfig   `json:"tracing" yaml:"tracing"`
+	AccessLog   AccessLogConfig `json:"access_log" yaml:"access_log"`
+	Faults      FaultsConfig    `json:"fault_injection" yaml:"fault_injection"`
+}
+
+type ServerConfig struct {
+	Address           string    `json:"address" yaml:"address"`
+	ReadTimeout       Duration  `json:"read_timeout" yaml:"read_timeout"`
+	ReadHeaderTimeout Duration  `json:"read_header_timeout" yaml:"read_header_timeout"`
+	WriteTimeout      Duration  `json:"write_timeout" yaml:"write_timeout"`
+	IdleTimeout       Duration  `json:"idle_timeout" yaml:"idle_timeout"`
+	MaxHeaderBytes    int       `json:"max_header_bytes" yaml:"max_header_bytes"`
+	ShutdownTimeout   Duration  `json:"shutdown_timeout" yaml:"shutdown_timeout"`
+	TLS               TLSConfig `json:"tls" yaml:"tls"`
+}
+
+//TLSConfig enables https when CertFile and KeyFile are set. ClientAuth is one
+//of none, optional or require; client certificates are verified against ClientCAFile.
+type TLSConfig struct {
+	CertFile     string `json:"cert_file" yaml:"cert_file"`
+	KeyFile      string `json:"key_file" yaml:"key_file"`
+	ClientCAFile string `json:"client_ca_file" yaml:"client_ca_file"`
+	ClientAuth   string `json:"client_auth" yaml:"client_auth"`
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+type AdminConfig struct {
+	Token string `json:"-" yaml:"-"`
+}
+
+type GithubConfig struct {
+	BaseURL          string               `json:"base_url" yaml:"base_url"`
+	Timeout          Duration             `json:"timeout" yaml:"timeout"`
+	MaxConcurrency   int                  `json:"max_concurrency" yaml:"max_concurrency"`
+	MaxResponseBytes int                  `json:"max_response_bytes" yaml:"max_response_bytes"`
+	Auth             string               `json:"auth" yaml:"auth"`
+	Token            TokenConfig          `json:"token" yaml:"token"`
+	App              AppConfig            `json:"app" yaml:"app"`
+	OAuth            OAuthConfig          `json:"oauth" yaml:"oauth"`
+	Retry            RetryConfig          `json:"retry" yaml:"retry"`
+	CircuitBreaker   CircuitBreakerConfig `json:"circuit_breaker" yaml:"circuit_breaker"`
+	RateLimit        RateLimitConfig      `json:"rate_limit" yaml:"rate_limit"`
+	Cache            CacheConfig          `json:"cache" yaml:"cache"`
+	Transport        TransportConfig      `json:"transport" yaml:"transport"`
+}
+
+//RetryConfig is the policy used by restclient to send failed calls again.
+//MaxAttempts counts the first attempt, 1 disables the retries.
+type RetryConfig struct {
+	MaxAttempts    int      `json:"max_attempts" yaml:"max_attempts"`
+	InitialBackoff Duration `json:"initial_backoff" yaml:"initial_backoff"`
+	MaxBackoff     Duration `json:"max_backoff" yaml:"max_backoff"`
+}
+
+//CircuitBreakerConfig configures the circuit breaker restclient keeps for
+//every host, see restclient.BreakerSettings.
+type CircuitBreakerConfig struct {
+	Enabled          bool     `json:"enabled" yaml:"enabled"`
+	FailureRatio     float64  `json:"failure_ratio" yaml:"failure_ratio"`
+	MinRequests      int      `json:"min_requests" yaml:"min_requests"`
+	Window           Duration `json:"window" yaml:"window"`
+	CoolDown         Duration `json:"cool_down" yaml:"cool_down"`
+	HalfOpenRequests int      `json:"half_open_requests" yaml:"half_open_requests"`
+}
+
+//RateLimitConfig configures the token bucket restclient keeps for every host,
+//see restclient.RateLimitSettings. OnExhausted is wait or fail.
+type RateLimitConfig struct {
+	Enabled           bool     `json:"enabled" yaml:"enabled"`
+	RequestsPerSecond float64  `json:"requests_per_second" yaml:"requests_per_second"`
+	Burst             int      `json:"burst" yaml:"burst"`
+	OnExhausted       string   `json:"on_exhausted" yaml:"on_exhausted"`
+	MaxWait           Duration `json:"max_wait" yaml:"max_wait"`
+}
+
+//CacheConfig configures the cache of GET responses kept by restclient, see
+//restclient.CacheSettings. MaxEntries sizes the default in-memory store.
+type CacheConfig struct {
+	Enabled      bool `json:"enabled" yaml:"enabled"`
+	MaxEntries   int  `json:"max_entries" yaml:"max_entries"`
+	MaxBodyBytes int  `json:"max_body_bytes" yaml:"max_body_bytes"`
+}
+
+//TransportConfig configures the connections of the restclient http client,
+//see restclient.TransportSettings. An empty Proxy uses the HTTP_PROXY,
+//HTTPS_PROXY and NO_PROXY environment variables.
+type TransportConfig struct {
+	DialTimeout         Duration `json:"dial_timeout" yaml:"dial_timeout"`
+	TLSHandshakeTimeout Duration `json:"tls_handshake_timeout" yaml:"tls_handshake_timeout"`
+	MaxIdleConnsPerHost int      `json:"max_idle_conns_per_host" yaml:"max_idle_conns_per_host"`
+	IdleConnTimeout     Duration `json:"idle_conn_timeout" yaml:"idle_conn_timeout"`
+	HTTP2               bool     `json:"http2" yaml:"http2"`
+	Proxy               string   `json:"proxy" yaml:"proxy"`
+	NoProxy             string   `json:"no_proxy" yaml:"no_proxy"`
+	CAFile              string   `json:"ca_file" yaml:"ca_file"`
+}
+
+//AppConfig describes the github App used when Auth is app. Installation
+//tokens are replaced RefreshBefore their expiry. An installation token has no
+//user, the repositories are created in the organization Org.
+type AppConfig struct {
+	ID             int      `json:"id" yaml:"id"`
+	InstallationID int      `json:"installation_id" yaml:"installation_id"`
+	PrivateKeyFile string   `json:"private_key_file" yaml:"private_key_file"`
+	Org            string   `json:"org" yaml:"org"`
+	RefreshBefore  Duration `json:"refresh_before" yaml:"refresh_before"`
+}
+
+//OAuthConfig enables the github login of the users, the oauth web flow, when
+//ClientID is set. A login must be completed within LoginTTL and the token
+//obtained is used for SessionTTL.
+type OAuthConfig struct {
+	ClientID     string   `json:"client_id" yaml:"client_id"`
+	ClientSecret string   `json:"-" yaml:"-"`
+	RedirectURL  string   `json:"redirect_url" yaml:"redirect_url"`
+	AuthorizeURL string   `json:"authorize_url" yaml:"authorize_url"`
+	TokenURL     string   `json:"token_url" yaml:"token_url"`
+	Scopes       []string `json:"scopes" yaml:"scopes"`
+	LoginTTL     Duration `json:"login_ttl" yaml:"login_ttl"`
+	SessionTTL   Duration `json:"session_ttl" yaml:"session_ttl"`
+}
+
+//TokenConfig tells where the github access token is read from.
+//Provider is one of env, file or encrypted_file.
+type TokenConfig struct {
+	Provider string `json:"provider" yaml:"provider"`
+	Env      string `json:"env" yaml:"env"`
+	File     string `json:"file" yaml:"file"`
+	Key      string `json:"-" yaml:"-"`
+}
+
+type LogConfig struct {
+	Level   string `json:"level" yaml:"level"`
+	Backend string `json:"backend" yaml:"backend"`
+}
+
+//TracingConfig selects where traces are exported. Exporter is one of none,
+//otlp (OTLP/HTTP to OTLPEndpoint), stdout or file.
+type TracingConfig struct {
+	Exporter     string  `json:"exporter" yaml:"exporter"`
+	ServiceName  string  `json:"service_name" yaml:"service_name"`
+	OTLPEndpoint string  `json:"otlp_endpoint" yaml:"otlp_endpoint"`
+	OTLPInsecure bool    `json:"otlp_insecure" yaml:"otlp_insecure"`
+	File         string  `json:"file" yaml:"file"`
+	SampleRatio  float64 `json:"sample_ratio" yaml:"sample_ratio"`
+}
+
+//AccessLogConfig controls the event written for every request. SampleRates maps a
+//route template to the ratio of successful requests that are logged, failed
+//requests are always logged.
+type AccessLogConfig struct {
+	Enabled       bool               `json:"enabled" yaml:"enabled"`
+	RedactHeaders []string           `json:"redact_headers" yaml:"redact_headers"`
+	RedactFields  []string           `json:"redact_fields" yaml:"redact_fields"`
+	LogBody       bool               `json:"log_body" yaml:"log_body"`
+	MaxBodyBytes  int                `json:"max_body_bytes" yaml:"max_body_bytes"`
+	SampleRates   map[string]float64 `json:"sample_rates" yaml:"sample_rates"`
+}
+
+//FaultsConfig injects Faults in the calls made by restclient, to test how the
+//api behaves when github is slow or failing. It can't be enabled in production.
+type FaultsConfig struct {
+	Enabled bool          `json:"enabled" yaml:"enabled"`
+	Faults  []FaultConfig `json:"faults" yaml:"faults"`
+}
+
+//FaultConfig delays Percent of the calls to Host whose path starts with Path,
+//then fails them with Error or answers them with Status.
+type FaultConfig struct {
+	Host    string   `json:"host,omitempty" yaml:"host,omitempty"`
+	Path    string   `json:"path,omitempty" yaml:"path,omitempty"`
+	Percent float64  `json:"percent" yaml:"percent"`
+	Delay   Duration `json:"delay" yaml:"delay"`
+	Status  int      `json:"status,omitempty" yaml:"status,omitempty"`
+	Error   string   `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+var (
+	mutex   sync.RWMutex
+	current Config
+)
+
+func init() {
+	cfg := Default()
+	//errors are reported when Load is called from main, here we just
+	//keep whatever could be applied so packages initialized before main work.
+	_ = applyEnv(&cfg, lookupEnv)
+	current = cfg
+}
+
+//Default returns the configuration used when nothing else is provided.
+func Default() Config {
+	return Config{
+		Environment: "development",
+		Server: ServerConfig{
+			Address:           "localhost:8080",
+			ReadTimeout:       Duration{30 * time.Second},
+			ReadHeaderTimeout: Duration{10 * time.Second},
+			WriteTimeout:      Duration{2 * time.Minute},
+			IdleTimeout:       Duration{2 * time.Minute},
+			MaxHeaderBytes:    1 << 20,
+			ShutdownTimeout:   Duration{30 * time.Second},
+			TLS: TLSConfig{
+				ClientAuth: ClientAuthNone,
+			},
+		},
+		Github: GithubConfig{
+			BaseURL:          "https://api.github.com",
+			Timeout:          Duration{10 * time.Second},
+			MaxConcurrency:   10,
+			MaxResponseBytes: 10 << 20,
+			Auth:             GithubAuthPAT,
+			Token: TokenConfig{
+				Provider: TokenProviderEnv,
+				Env:      "SECRET_GITHUB_ACCESS_TOKEN",
+			},
+			App: AppConfig{
+				RefreshBefore: Duration{5 * time.Minute},
+			},
+			OAuth: OAuthConfig{
+				AuthorizeURL: "https://github.com/login/oauth/authorize",
+				TokenURL:     "https://github.com/login/oauth/access_token",
+				Scopes:       []string{"repo"},
+				LoginTTL:     Duration{10 * time.Minute},
+				SessionTTL:   Duration{24 * time.Hour},
+			},
+			Retry: RetryConfig{
+				MaxAttempts:    3,
+				InitialBackoff: Duration{200 * time.Millisecond},
+				MaxBackoff:     Duration{5 * time.Second},
+			},
+			CircuitBreaker: CircuitBreakerConfig{
+				Enabled:          true,
+				FailureRatio:     0.5,
+				MinRequests:      10,
+				Window:           Duration{30 * time.Second},
+				CoolDown:         Duration{30 * time.Second},
+				HalfOpenRequests: 1,
+			},
+			RateLimit: RateLimitConfig{
+				Enabled:           true,
+				RequestsPerSecond: 10,
+				Burst:             20,
+				OnExhausted:       RateLimitFail,
+				MaxWait:           Duration{time.Minute},
+			},
+			Cache: CacheConfig{
+				Enabled:      true,
+				MaxEntries:   1000,
+				MaxBodyBytes: 256 << 10,
+			},
+			Transport: TransportConfig{
+				DialTimeout:         Duration{5 * time.Second},
+				TLSHandshakeTimeout: Duration{5 * time.Second},
+				MaxIdleConnsPerHost: 10,
+				IdleConnTimeout:     Duration{90 * time.Second},
+				HTTP2:               true,
+			},
+		},
+		Log: LogConfig{
+			Level:   "info",
+			Backend: "zap",
+		},
+		Tracing: TracingConfig{
+			Exporter:     TracingExporterNone,
+			ServiceName:  "golang-microservices",
+			OTLPEndpoint: "localhost:4318",
+			SampleRatio:  1,
+		},
+		AccessLog: AccessLogConfig{
+			Enabled:       true,
+			RedactHeaders: []string{"Authorization", "X-GitHub-Token", "Cookie", "Set-Cookie"},
+			RedactFields:  []string{"password", "token", "access_token", "secret"},
+			MaxBodyBytes:  4096,
+			SampleRates:   map[string]float64{"/marco": 0.01},
+		},
+	}
+}
+
+//Get returns a copy of the current configuration.
+func Get() Config {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return current
+}
+
+//Set replaces the current configuration. It is meant to be used by Load and by tests.
+func Set(cfg Config) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	current = cfg
+}
+
+func IsProduction() bool {
+	return Get().Production()
+}
+
+//Production tells whether c is the configuration of production.
+func (c Config) Production() bool {
+	return c.Environment == production
+}
+
+//ValidationError lists every configuration key holding an invalid value.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration: %s", strings.Join(e.Problems, "; "))
+}
+
+func (e *ValidationError) add(key string, format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf("%s: %s", key, fmt.Sprintf(format, args...)))
+}
+
+func (e *ValidationError) positive(key string, value Duration) {
+	if value.Duration <= 0 {
+		e.add(key, "must be greater than zero, got %s", value)
+	}
+}
+
+func (e *ValidationError) absoluteURL(key string, value string) {
+	if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+		e.add(key, "must be an absolute url, got %q", value)
+	}
+}
+
+//Validate checks the configuration and returns a *ValidationError naming each bad key.
+func (c Config) Validate() error {
+	verr := &ValidationError{}
+
+	if strings.TrimSpace(c.Environment) == "" {
+		verr.add("environment", "must not be empty")
+	}
+	if strings.TrimSpace(c.Server.Address) == "" {
+		verr.add("server.address", "must not be empty")
+	}
+	verr.positive("server.read_timeout", c.Server.ReadTimeout)
+	verr.positive("server.read_header_timeout", c.Server.ReadHeaderTimeout)
+	verr.positive("server.write_timeout", c.Server.WriteTimeout)
+	verr.positive("server.idle_timeout", c.Server.IdleTimeout)
+	verr.positive("server.shutdown_timeout", c.Server.ShutdownTimeout)
+	if c.Server.MaxHeaderBytes < 1024 {
+		verr.add("server.max_header_bytes", "must be at least 1024, got %d", c.Server.MaxHeaderBytes)
+	}
+	if !strings.HasPrefix(c.Github.BaseURL, "http://") && !strings.HasPrefix(c.Github.BaseURL, "https://") {
+		verr.add("github.base_url", "must be an http or https url, got %q", c.Github.BaseURL)
+	}
+	if (c.Server.TLS.CertFile == "") != (c.Server.TLS.KeyFile == "") {
+		verr.add("server.tls.key_file", "server.tls.cert_file and server.tls.key_file must be set together")
+	}
+	switch c.Server.TLS.ClientAuth {
+	case ClientAuthNone:
+	case ClientAuthOptional, ClientAuthRequire:
+		if !c.Server.TLS.Enabled() {
+			verr.add("server.tls.client_auth", "requires server.tls.cert_file and server.tls.key_file")
+		}
+		if c.Server.TLS.ClientCAFile == "" {
+			verr.add("server.tls.client_ca_file", "must not be empty when server.tls.client_auth is %s", c.Server.TLS.ClientAuth)
+		}
+	default:
+		verr.add("server.tls.client_auth", "must be one of %s, %s or %s, got %q",
+			ClientAuthNone, ClientAuthOptional, ClientAuthRequire, c.Server.TLS.ClientAuth)
+	}
+	verr.positive("github.timeout", c.Github.Timeout)
+	if c.Github.MaxConcurrency < 1 {
+		verr.add("github.max_concurrency", "must be at least 1, got %d", c.Github.MaxConcurrency)
+	}
+	if c.Github.MaxResponseBytes < 1 {
+		verr.add("github.max_response_bytes", "must be at least 1, got %d", c.Github.MaxResponseBytes)
+	}
+	if c.Github.Retry.MaxAttempts < 1 {
+		verr.add("github.retry.max_attempts", "must be at least 1, got %d", c.Github.Retry.MaxAttempts)
+	}
+	verr.positive("github.retry.initial_backoff", c.Github.Retry.InitialBackoff)
+	if c.Github.Retry.MaxBackoff.Duration < c.Github.Retry.InitialBackoff.Duration {
+		verr.add("github.retry.max_backoff", "must not be lower than github.retry.initial_backoff, got %s", c.Github.Retry.MaxBackoff)
+	}
+	if c.Github.CircuitBreaker.FailureRatio <= 0 || c.Github.CircuitBreaker.FailureRatio > 1 {
+		verr.add("github.circuit_breaker.failure_ratio", "must be greater than 0 and at most 1, got %g", c.Github.CircuitBreaker.FailureRatio)
+	}
+	if c.Github.CircuitBreaker.MinRequests < 1 {
+		verr.add("github.circuit_breaker.min_requests", "must be at least 1, got %d", c.Github.CircuitBreaker.MinRequests)
+	}
+	verr.positive("github.circuit_breaker.window", c.Github.CircuitBreaker.Window)
+	verr.positive("github.circuit_breaker.cool_down", c.Github.CircuitBreaker.CoolDown)
+	if c.Github.CircuitBreaker.HalfOpenRequests < 1 {
+		verr.add("github.circuit_breaker.half_open_requests", "must be at least 1, got %d", c.Github.CircuitBreaker.HalfOpenRequests)
+	}
+	if c.Github.RateLimit.RequestsPerSecond <= 0 {
+		verr.add("github.rate_limit.requests_per_second", "must be greater than zero, got %g", c.Github.RateLimit.RequestsPerSecond)
+	}
+	if c.Github.RateLimit.Burst < 1 {
+		verr.add("github.rate_limit.burst", "must be at least 1, got %d", c.Github.RateLimit.Burst)
+	}
+	if c.Github.RateLimit.OnExhausted != RateLimitWait && c.Github.RateLimit.OnExhausted != RateLimitFail {
+		verr.add("github.rate_limit.on_exhausted", "must be %s or %s, got %q", RateLimitWait, RateLimitFail, c.Github.RateLimit.OnExhausted)
+	}
+	verr.positive("github.rate_limit.max_wait", c.Github.RateLimit.MaxWait)
+	if c.Github.Cache.MaxEntries < 1 {
+		verr.add("github.cache.max_entries", "must be at least 1, got %d", c.Github.Cache.MaxEntries)
+	}
+	if c.Github.Cache.MaxBodyBytes < 1 {
+		verr.add("github.cache.max_body_bytes", "must be at least 1, got %d", c.Github.Cache.MaxBodyBytes)
+	}
+	verr.positive("github.transport.dial_timeout", c.Github.Transport.DialTimeout)
+	verr.positive("github.transport.tls_handshake_timeout", c.Github.Transport.TLSHandshakeTimeout)
+	verr.positive("github.transport.idle_conn_timeout", c.Github.Transport.IdleConnTimeout)
+	if c.Github.Transport.MaxIdleConnsPerHost < 1 {
+		verr.add("github.transport.max_idle_conns_per_host", "must be at least 1, got %d", c.Github.Transport.MaxIdleConnsPerHost)
+	}
+	if c.Github.Transport.Proxy != "" {
+		if proxy, err := url.Parse(c.Github.Transport.Proxy); err != nil || proxy.Scheme == "" || proxy.Host == "" {
+			verr.add("github.transport.proxy", "must be an absolute url, got %q", c.Github.Transport.Proxy)
+		}
+	}
+	switch c.Github.Auth {
+	case GithubAuthPAT:
+	case GithubAuthApp:
+		if c.Github.App.ID < 1 {
+			verr.add("github.app.id", "must be set when github.auth is %s", GithubAuthApp)
+		}
+		if c.Github.App.InstallationID < 1 {
+			verr.add("github.app.installation_id", "must be set when github.auth is %s", GithubAuthApp)
+		}
+		if c.Github.App.PrivateKeyFile == "" {
+			verr.add("github.app.private_key_file", "must not be empty when github.auth is %s", GithubAuthApp)
+		}
+		if c.Github.App.Org == "" {
+			verr.add("github.app.org", "must not be empty when github.auth is %s", GithubAuthApp)
+		}
+	default:
+		verr.add("github.auth", "must be %s or %s, got %q", GithubAuthPAT, GithubAuthApp, c.Github.Auth)
+	}
+	verr.positive("github.app.refresh_before", c.Github.App.RefreshBefore)
+	if c.Github.OAuth.ClientID != "" {
+		if c.Github.OAuth.ClientSecret == "" {
+			verr.add("github.oauth.client_secret", "must not be empty when github.oauth.client_id is set")
+		}
+		verr.absoluteURL("github.oauth.redirect_url", c.Github.OAuth.RedirectURL)
+		verr.absoluteURL("github.oauth.authorize_url", c.Github.OAuth.AuthorizeURL)
+		verr.absoluteURL("github.oauth.token_url", c.Github.OAuth.TokenURL)
+	}
+	verr.positive("github.oauth.login_ttl", c.Github.OAuth.LoginTTL)
+	verr.positive("github.oauth.session_ttl", c.Github.OAuth.SessionTTL)
+	switch c.Github.Token.Provider {
+	case TokenProviderEnv:
+		if c.Github.Token.Env == "" {
+			verr.add("github.token.env", "must not be empty when github.token.provider is %s", TokenProviderEnv)
+		}
+	case TokenProviderFile, TokenProviderEncryptedFile:
+		if c.Github.Token.File == "" {
+			verr.add("github.token.file", "must not be empty when github.token.provider is %s", c.Github.Token.Provider)
+		}
+		if c.Github.Token.Provider == TokenProviderEncryptedFile && c.Github.Token.Key == "" {
+			verr.add("github.token.key", "must not be empty when github.token.provider is %s", TokenProviderEncryptedFile)
+		}
+	default:
+		verr.add("github.token.provider", "must be one of %s, %s or %s, got %q",
+			TokenProviderEnv, TokenProviderFile, TokenProviderEncryptedFile, c.Github.Token.Provider)
+	}
+	if !isValidLevel(c.Log.Level) {
+		verr.add("log.level", "unknown level %q", c.Log.Level)
+	}
+	if c.Log.Backend != "zap" && c.Log.Backend != "logrus" {
+		verr.add("log.backend", "must be zap or logrus, got %q", c.Log.Backend)
+	}
+	switch c.Tracing.Exporter {
+	case TracingExporterNone, TracingExporterStdout:
+	case TracingExporterOTLP:
+		if c.Tracing.OTLPEndpoint == "" {
+			verr.add("tracing.otlp_endpoint", "must not be empty when tracing.exporter is %s", TracingExporterOTLP)
+		}
+	case TracingExporterFile:
+		if c.Tracing.File == "" {
+			verr.add("tracing.file", "must not be empty when tracing.exporter is %s", TracingExporterFile)
+		}
+	default:
+		verr.add("tracing.exporter", "must be one of %s, %s, %s or %s, got %q",
+			TracingExporterNone, TracingExporterOTLP, TracingExporterStdout, TracingExporterFile, c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		verr.add("tracing.sample_ratio", "must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+	if c.AccessLog.MaxBodyBytes < 0 {
+		verr.add("access_log.max_body_bytes", "must not be negative, got %d", c.AccessLog.MaxBodyBytes)
+	}
+	for _, route := range sortedKeys(c.AccessLog.SampleRates) {
+		if rate := c.AccessLog.SampleRates[route]; rate < 0 || rate > 1 {
+			verr.add("access_log.sample_rates", "rate of %s must be between 0 and 1, got %g", route, rate)
+		}
+	}
+	if c.Faults.Enabled && c.Environment == production {
+		verr.add("fault_injection.enabled", "can not be enabled in production")
+	}
+	for i, fault := range c.Faults.Faults {
+		if fault.Percent <= 0 || fault.Percent > 100 {
+			verr.add("fault_injection.faults", "percent of fault %d must be greater than 0 and at most 100, got %g", i, fault.Percent)
+		}
+		if fault.Delay.Duration < 0 {
+			verr.add("fault_injection.faults", "delay of fault %d must not be negative, got %s", i, fault.Delay)
+		}
+		if fault.Status != 0 && (fault.Status < 100 || fault.Status > 599) {
+			verr.add("fault_injection.faults", "status of fault %d must be between 100 and 599, got %d", i, fault.Status)
+		}
+		if fault.Status != 0 && fault.Error != "" {
+			verr.add("fault_injection.faults", "fault %d can not have both a status and an error", i)
+		}
+		if fault.Delay.Duration == 0 && fault.Status == 0 && fault.Error == "" {
+			verr.add("fault_injection.faults", "fault %d must have a delay, a status or an error", i)
+		}
+	}
+
+	if len(verr.Problems) > 0 {
+		return verr
+	}
+	return nil
+}
+
+func isValidLevel(level string) bool {
+	switch strings.ToLower(level) {
+	case "debug", "info", "warn", "error":
+		return true
+	}
+	return false
+}
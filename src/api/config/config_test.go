@@ -0,0 +1,167 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func noEnv(string) (string, bool) {
+	return "", false
+}
+
+func envFrom(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := values[key]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	dir, err := ioutil.TempDir("", "config")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, name)
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func overwrite(path string, content string) error {
+	return ioutil.WriteFile(path, []byte(content), 0600)
+}
+
+func TestDefaults(t *testing.T) {
+	cfg, _, err := load(nil, noEnv)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "localhost:8080", cfg.Server.Address)
+	assert.EqualValues(t, "https://api.github.com", cfg.Github.BaseURL)
+	assert.EqualValues(t, "info", cfg.Log.Level)
+}
+
+func TestLayeringOrder(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+server:
+  address: ":9000"
+github:
+  base_url: "https://github.example.com/api/v3"
+log:
+  level: debug
+`)
+	env := envFrom(map[string]string{
+		"CONFIG_FILE": path,
+		"LOG_LEVEL":   "warn",
+	})
+
+	cfg, _, err := load([]string{"-log.level", "error"}, env)
+	assert.Nil(t, err)
+	assert.EqualValues(t, ":9000", cfg.Server.Address)                             //from file
+	assert.EqualValues(t, "https://github.example.com/api/v3", cfg.Github.BaseURL) //from file
+	assert.EqualValues(t, "error", cfg.Log.Level)                                  //flag wins over env and file
+}
+
+func TestLoadJSONFile(t *testing.T) {
+	path := writeFile(t, "config.json", `{"environment":"production","server":{"address":":7000"}}`)
+
+	cfg, _, err := load([]string{"-config", path}, noEnv)
+	assert.Nil(t, err)
+	assert.EqualValues(t, ":7000", cfg.Server.Address)
+	assert.EqualValues(t, "production", cfg.Environment)
+}
+
+func TestLoadFileUnknownKey(t *testing.T) {
+	path := writeFile(t, "config.yaml", "server:\n  adress: \":9000\"\n")
+
+	_, _, err := load([]string{"-config", path}, noEnv)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "adress")
+}
+
+func TestValidateNamesEveryBadKey(t *testing.T) {
+	_, _, err := load([]string{"-server.address", "", "-github.base_url", "api.github.com", "-log.level", "verbose"}, noEnv)
+	assert.NotNil(t, err)
+
+	verr, ok := err.(*ValidationError)
+	assert.True(t, ok)
+	assert.EqualValues(t, 3, len(verr.Problems))
+	assert.Contains(t, err.Error(), "server.address")
+	assert.Contains(t, err.Error(), "github.base_url")
+	assert.Contains(t, err.Error(), "log.level")
+}
+
+func TestIsProduction(t *testing.T) {
+	previous := Get()
+	defer Set(previous)
+
+	cfg := Default()
+	cfg.Environment = "production"
+	Set(cfg)
+	assert.True(t, IsProduction())
+}
+
+func TestAccessLogListsFromEnv(t *testing.T) {
+	env := envFrom(map[string]string{
+		"ACCESS_LOG_REDACT_FIELDS": "password, pin,",
+		"ACCESS_LOG_SAMPLE_RATES":  "/marco=0.5,/repository=0",
+	})
+
+	cfg, _, err := load(nil, env)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"password", "pin"}, cfg.AccessLog.RedactFields)
+	assert.EqualValues(t, map[string]float64{"/marco": 0.5, "/repository": 0}, cfg.AccessLog.SampleRates)
+
+	_, _, err = load([]string{"-access_log.sample_rates", "/marco=2"}, noEnv)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "access_log.sample_rates")
+}
+
+func TestFaultsFromEnv(t *testing.T) {
+	env := envFrom(map[string]string{
+		"FAULT_INJECTION_ENABLED": "true",
+		"FAULT_INJECTION_FAULTS":  `[{"host":"api.github.com","path":"/user/repos","percent":10,"delay":"2s"}]`,
+	})
+
+	cfg, _, err := load(nil, env)
+	assert.Nil(t, err)
+	assert.True(t, cfg.Faults.Enabled)
+	assert.EqualValues(t, []FaultConfig{{Host: "api.github.com", Path: "/user/repos", Percent: 10, Delay: Duration{2 * time.Second}}}, cfg.Faults.Faults)
+
+	_, _, err = load([]string{"-fault_injection.faults", `[{"percent":150},{"percent":5,"status":503,"error":"reset"}]`}, noEnv)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, 3, len(err.(*ValidationError).Problems))
+}
+
+func TestFaultsRefusedInProduction(t *testing.T) {
+	_, _, err := load([]string{"-environment", "production", "-fault_injection.enabled", "true"}, noEnv)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "fault_injection.enabled: can not be enabled in production")
+
+	_, _, err = load([]string{"-environment", "production", "-fault_injection.faults", `[{"percent":10,"status":500}]`}, noEnv)
+	assert.Nil(t, err)
+}
+
+func TestGithubAppAuth(t *testing.T) {
+	_, _, err := load([]string{"-github.auth", "app"}, noEnv)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, 4, len(err.(*ValidationError).Problems))
+	assert.Contains(t, err.Error(), "github.app.private_key_file")
+	assert.Contains(t, err.Error(), "github.app.org")
+
+	env := envFrom(map[string]string{"GITHUB_AUTH": "app", "GITHUB_APP_ID": "7", "GITHUB_APP_INSTALLATION_ID": "42", "GITHUB_APP_PRIVATE_KEY_FILE": "app.pem", "GITHUB_APP_ORG": "jebo-org"})
+	cfg, _, err := load(nil, env)
+	assert.Nil(t, err)
+	assert.EqualValues(t, AppConfig{ID: 7, InstallationID: 42, PrivateKeyFile: "app.pem", Org: "jebo-org", RefreshBefore: Duration{5 * time.Minute}}, cfg.Github.App)
+}
+
+func TestSecretsAreNotFlags(t *testing.T) {
+	_, _, err := load([]string{"-admin.token", "s3cr3t"}, noEnv)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "flag provided but not defined: -admin.token")
+
+	cfg, _, err := load(nil, envFrom(map[string]string{"SECRET_ADMIN_TOKEN": "s3cr3t"}))
+	assert.Nil(t, err)
+	assert.EqualValues(t, "s3cr3t", cfg.Admin.Token)
+}
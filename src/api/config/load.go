@@ -0,0 +1,139 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	envConfigFile = "CONFIG_FILE"
+	flagConfig    = "config"
+)
+
+var (
+	//args given to Load, kept so Reload applies the same layers again.
+	loadedArgs []string
+	//values changed at runtime through Update, applied on top of every other layer.
+	overrides = make(map[string]string)
+)
+
+func lookupEnv(key string) (string, bool) {
+	return os.LookupEnv(key)
+}
+
+//Load builds the configuration from defaults, then the config file, then
+//environment variables and finally the given command line arguments.
+//The result is validated before it replaces the current configuration.
+func Load(args []string) error {
+	cfg, path, err := load(args, lookupEnv)
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	loadedArgs = args
+	filePath = path
+	mutex.Unlock()
+
+	Set(cfg)
+	return nil
+}
+
+func load(args []string, env func(string) (string, bool)) (Config, string, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+	configFile := fs.String(flagConfig, "", "path to a yaml or json config file")
+	values := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		//secrets would be visible to anyone listing the processes
+		if s.secret {
+			continue
+		}
+		values[s.key] = fs.String(s.key, "", fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, "", err
+	}
+
+	path := *configFile
+	if path == "" {
+		path, _ = env(envConfigFile)
+	}
+	if path != "" {
+		if err := loadFile(&cfg, path); err != nil {
+			return cfg, path, err
+		}
+	}
+
+	if err := applyEnv(&cfg, env); err != nil {
+		return cfg, path, err
+	}
+
+	verr := &ValidationError{}
+	fs.Visit(func(f *flag.Flag) {
+		if s, ok := findSetting(f.Name); ok {
+			if err := s.set(&cfg, *values[s.key]); err != nil {
+				verr.add(s.key, "%s", err)
+			}
+		}
+	})
+	if len(verr.Problems) > 0 {
+		return cfg, path, verr
+	}
+
+	cfg.normalize()
+	return cfg, path, cfg.Validate()
+}
+
+func loadFile(cfg *Config, path string) error {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file %s: %s", path, err)
+	}
+	if err := decode(cfg, path, bytes); err != nil {
+		return fmt.Errorf("error parsing config file %s: %s", path, err)
+	}
+	return nil
+}
+
+func decode(cfg *Config, path string, content []byte) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		return decoder.Decode(cfg)
+	case ".yaml", ".yml":
+		return yaml.UnmarshalStrict(content, cfg)
+	}
+	return fmt.Errorf("unsupported config file extension %q", filepath.Ext(path))
+}
+
+func applyEnv(cfg *Config, env func(string) (string, bool)) error {
+	verr := &ValidationError{}
+	for _, s := range settings {
+		value, ok := env(s.env)
+		if !ok {
+			continue
+		}
+		if err := s.set(cfg, value); err != nil {
+			verr.add(s.key, "%s (from %s)", err, s.env)
+		}
+	}
+	if len(verr.Problems) > 0 {
+		return verr
+	}
+	return nil
+}
+
+func (c *Config) normalize() {
+	c.Github.BaseURL = strings.TrimSuffix(c.Github.BaseURL, "/")
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+//Change is a single key whose value changed after a reload or an update.
+//Secret values are masked.
+type Change struct {
+	Key      string `json:"key"`
+	Previous string `json:"previous"`
+	Current  string `json:"current"`
+}
+
+//Listener is notified with the previous and the new configuration every
+//time the configuration changes at runtime.
+type Listener func(previous Config, current Config, changes []Change)
+
+const masked = "******"
+
+var (
+	filePath string
+
+	listenersMutex sync.Mutex
+	listeners      []Listener
+)
+
+//OnChange registers a listener called after every runtime change.
+func OnChange(listener Listener) {
+	listenersMutex.Lock()
+	defer listenersMutex.Unlock()
+	listeners = append(listeners, listener)
+}
+
+//Reload loads the configuration again with the arguments given to Load.
+//Only reloadable keys are taken from the new configuration; the rest need a restart.
+func Reload() ([]Change, error) {
+	mutex.RLock()
+	args := loadedArgs
+	mutex.RUnlock()
+
+	loaded, _, err := load(args, lookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	return apply(func(cfg *Config) error {
+		for _, s := range settings {
+			if s.reloadable {
+				if err := s.set(cfg, s.get(&loaded)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}, nil)
+}
+
+//Update changes the given reloadable keys at runtime. The values survive
+//later reloads until the process is restarted.
+func Update(values map[string]string) ([]Change, error) {
+	verr := &ValidationError{}
+	for key := range values {
+		s, ok := findSetting(key)
+		if !ok {
+			verr.add(key, "unknown key")
+		} else if !s.reloadable {
+			verr.add(key, "can not be changed at runtime")
+		}
+	}
+	if len(verr.Problems) > 0 {
+		return nil, verr
+	}
+
+	return apply(func(cfg *Config) error {
+		for key, value := range values {
+			s, _ := findSetting(key)
+			if err := s.set(cfg, value); err != nil {
+				verr.add(key, "%s", err)
+			}
+		}
+		if len(verr.Problems) > 0 {
+			return verr
+		}
+		return nil
+	}, values)
+}
+
+//apply runs change on a copy of the current configuration, then validates,
+//stores and announces the result.
+func apply(change func(cfg *Config) error, newOverrides map[string]string) ([]Change, error) {
+	mutex.Lock()
+	previous := current
+	next := current
+	if err := change(&next); err != nil {
+		mutex.Unlock()
+		return nil, err
+	}
+	//runtime overrides always win over the reloaded layers
+	for key, value := range overrides {
+		if _, ok := newOverrides[key]; ok {
+			continue
+		}
+		s, _ := findSetting(key)
+		_ = s.set(&next, value)
+	}
+	next.normalize()
+	if err := next.Validate(); err != nil {
+		mutex.Unlock()
+		return nil, err
+	}
+	for key, value := range newOverrides {
+		overrides[key] = value
+	}
+	current = next
+	mutex.Unlock()
+
+	changes := Diff(previous, next)
+	if len(changes) > 0 {
+		listenersMutex.Lock()
+		defer listenersMutex.Unlock()
+		for _, listener := range listeners {
+			listener(previous, next, changes)
+		}
+	}
+	return changes, nil
+}
+
+//Diff lists the keys that differ between two configurations, sorted by key.
+func Diff(previous Config, current Config) []Change {
+	changes := make([]Change, 0)
+	for _, s := range settings {
+		before, after := s.get(&previous), s.get(&current)
+		if before == after {
+			continue
+		}
+		if s.secret {
+			before, after = masked, masked
+		}
+		changes = append(changes, Change{Key: s.key, Previous: before, Current: after})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+//Values returns every key of the current configuration with secrets masked.
+func Values() map[string]string {
+	cfg := Get()
+	result := make(map[string]string, len(settings))
+	for _, s := range settings {
+		value := s.get(&cfg)
+		if s.secret && value != "" {
+			value = masked
+		}
+		result[s.key] = value
+	}
+	return result
+}
+
+//Watch polls the config file given to Load and reloads the configuration
+//when it changes. Reload errors are passed to onError and the previous
+//configuration is kept. Calling the returned function stops the watch.
+func Watch(interval time.Duration, onError func(error)) (stop func()) {
+	mutex.RLock()
+	path := filePath
+	mutex.RUnlock()
+
+	done := make(chan struct{})
+	if path == "" {
+		return func() { close(done) }
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		last := modTime(path)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				changed := modTime(path)
+				if changed.Equal(last) {
+					continue
+				}
+				last = changed
+				if _, err := Reload(); err != nil {
+					onError(fmt.Errorf("error reloading config file %s: %s", path, err))
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
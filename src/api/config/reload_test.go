@@ -0,0 +1,95 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func resetRuntimeState(t *testing.T) {
+	previous := Get()
+	t.Cleanup(func() {
+		Set(previous)
+		overrides = make(map[string]string)
+		loadedArgs = nil
+		filePath = ""
+		listeners = nil
+	})
+}
+
+func TestUpdateRuntimeKeys(t *testing.T) {
+	resetRuntimeState(t)
+	Set(Default())
+
+	var notified []Change
+	OnChange(func(previous Config, current Config, changes []Change) {
+		notified = changes
+	})
+
+	changes, err := Update(map[string]string{"log.level": "debug", "github.timeout": "3s"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, len(changes))
+	assert.EqualValues(t, "github.timeout", changes[0].Key)
+	assert.EqualValues(t, "10s", changes[0].Previous)
+	assert.EqualValues(t, "3s", changes[0].Current)
+	assert.EqualValues(t, changes, notified)
+
+	assert.EqualValues(t, "debug", Get().Log.Level)
+	assert.EqualValues(t, 3*time.Second, Get().Github.Timeout.Duration)
+}
+
+func TestUpdateRejectsStaticAndInvalidKeys(t *testing.T) {
+	resetRuntimeState(t)
+	Set(Default())
+
+	_, err := Update(map[string]string{"server.address": ":9000", "foo": "bar"})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "server.address: can not be changed at runtime")
+	assert.Contains(t, err.Error(), "foo: unknown key")
+
+	_, err = Update(map[string]string{"github.max_concurrency": "0"})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "github.max_concurrency")
+	assert.EqualValues(t, 10, Get().Github.MaxConcurrency)
+}
+
+func TestReloadKeepsStaticKeysAndOverrides(t *testing.T) {
+	resetRuntimeState(t)
+	path := writeFile(t, "config.yaml", "log:\n  level: warn\n")
+	assert.Nil(t, Load([]string{"-config", path}))
+	assert.EqualValues(t, "warn", Get().Log.Level)
+
+	_, err := Update(map[string]string{"github.max_concurrency": "2"})
+	assert.Nil(t, err)
+
+	assert.Nil(t, overwrite(path, "server:\n  address: \":9999\"\nlog:\n  level: error\ngithub:\n  max_concurrency: 50\n"))
+	changes, err := Reload()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(changes))
+	assert.EqualValues(t, "error", Get().Log.Level)
+	assert.EqualValues(t, "localhost:8080", Get().Server.Address) //needs a restart
+	assert.EqualValues(t, 2, Get().Github.MaxConcurrency)         //runtime override wins
+}
+
+func TestReloadInvalidFileKeepsConfig(t *testing.T) {
+	resetRuntimeState(t)
+	path := writeFile(t, "config.yaml", "log:\n  level: warn\n")
+	assert.Nil(t, Load([]string{"-config", path}))
+
+	assert.Nil(t, overwrite(path, "log:\n  level: loud\n"))
+	_, err := Reload()
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "warn", Get().Log.Level)
+}
+
+func TestDiffMasksSecrets(t *testing.T) {
+	previous := Default()
+	current := Default()
+	current.Admin.Token = "abc123"
+
+	changes := Diff(previous, current)
+	assert.EqualValues(t, 1, len(changes))
+	assert.EqualValues(t, "admin.token", changes[0].Key)
+	assert.NotContains(t, changes[0].Current, "abc123")
+}
@@ -0,0 +1,498 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//setting describes a single configuration key that can be overridden
+//from the environment, the command line and, when reloadable, at runtime.
+type setting struct {
+	key        string
+	env        string
+	usage      string
+	secret     bool
+	reloadable bool
+	get        func(c *Config) string
+	set        func(c *Config, value string) error
+}
+
+func stringSetting(key string, env string, usage string, field func(c *Config) *string) setting {
+	return setting{
+		key:   key,
+		env:   env,
+		usage: usage,
+		get: func(c *Config) string {
+			return *field(c)
+		},
+		set: func(c *Config, value string) error {
+			*field(c) = value
+			return nil
+		},
+	}
+}
+
+func durationSetting(key string, env string, usage string, field func(c *Config) *Duration) setting {
+	return setting{
+		key:   key,
+		env:   env,
+		usage: usage,
+		get: func(c *Config) string {
+			return field(c).String()
+		},
+		set: func(c *Config, value string) error {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("invalid duration %q", value)
+			}
+			field(c).Duration = d
+			return nil
+		},
+	}
+}
+
+func intSetting(key string, env string, usage string, field func(c *Config) *int) setting {
+	return setting{
+		key:   key,
+		env:   env,
+		usage: usage,
+		get: func(c *Config) string {
+			return strconv.Itoa(*field(c))
+		},
+		set: func(c *Config, value string) error {
+			i, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid integer %q", value)
+			}
+			*field(c) = i
+			return nil
+		},
+	}
+}
+
+func floatSetting(key string, env string, usage string, field func(c *Config) *float64) setting {
+	return setting{
+		key:   key,
+		env:   env,
+		usage: usage,
+		get: func(c *Config) string {
+			return strconv.FormatFloat(*field(c), 'g', -1, 64)
+		},
+		set: func(c *Config, value string) error {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("invalid number %q", value)
+			}
+			*field(c) = f
+			return nil
+		},
+	}
+}
+
+func boolSetting(key string, env string, usage string, field func(c *Config) *bool) setting {
+	return setting{
+		key:   key,
+		env:   env,
+		usage: usage,
+		get: func(c *Config) string {
+			return strconv.FormatBool(*field(c))
+		},
+		set: func(c *Config, value string) error {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid boolean %q", value)
+			}
+			*field(c) = b
+			return nil
+		},
+	}
+}
+
+//listSetting reads a comma separated list, empty items are dropped.
+func listSetting(key string, env string, usage string, field func(c *Config) *[]string) setting {
+	return setting{
+		key:   key,
+		env:   env,
+		usage: usage,
+		get: func(c *Config) string {
+			return strings.Join(*field(c), ",")
+		},
+		set: func(c *Config, value string) error {
+			items := []string{}
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			*field(c) = items
+			return nil
+		},
+	}
+}
+
+//ratesSetting reads comma separated route=ratio pairs, like "/marco=0.01,/repository=1".
+func ratesSetting(key string, env string, usage string, field func(c *Config) *map[string]float64) setting {
+	return setting{
+		key:   key,
+		env:   env,
+		usage: usage,
+		get: func(c *Config) string {
+			rates := *field(c)
+			pairs := make([]string, 0, len(rates))
+			for _, route := range sortedKeys(rates) {
+				pairs = append(pairs, route+"="+strconv.FormatFloat(rates[route], 'g', -1, 64))
+			}
+			return strings.Join(pairs, ",")
+		},
+		set: func(c *Config, value string) error {
+			//a new map is built so copies returned by Get are never modified
+			rates := make(map[string]float64)
+			for _, pair := range strings.Split(value, ",") {
+				if pair = strings.TrimSpace(pair); pair == "" {
+					continue
+				}
+				separator := strings.LastIndex(pair, "=")
+				if separator <= 0 {
+					return fmt.Errorf("invalid route rate %q, expected route=ratio", pair)
+				}
+				rate, err := strconv.ParseFloat(pair[separator+1:], 64)
+				if err != nil {
+					return fmt.Errorf("invalid route rate %q, expected route=ratio", pair)
+				}
+				rates[strings.TrimSpace(pair[:separator])] = rate
+			}
+			*field(c) = rates
+			return nil
+		},
+	}
+}
+
+//faultsSetting reads the faults as a json array, like
+//[{"host":"api.github.com","percent":10,"status":503}].
+func faultsSetting(key string, env string, usage string, field func(c *Config) *[]FaultConfig) setting {
+	return setting{
+		key:   key,
+		env:   env,
+		usage: usage,
+		get: func(c *Config) string {
+			faults := *field(c)
+			if len(faults) == 0 {
+				return ""
+			}
+			encoded, _ := json.Marshal(faults)
+			return string(encoded)
+		},
+		set: func(c *Config, value string) error {
+			//a new slice is built so copies returned by Get are never modified
+			var faults []FaultConfig
+			if strings.TrimSpace(value) != "" {
+				if err := json.Unmarshal([]byte(value), &faults); err != nil {
+					return fmt.Errorf("invalid faults %q, expected a json array: %s", value, err)
+				}
+			}
+			*field(c) = faults
+			return nil
+		},
+	}
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s setting) runtime() setting {
+	s.reloadable = true
+	return s
+}
+
+func (s setting) hidden() setting {
+	s.secret = true
+	return s
+}
+
+var settings = []setting{
+	stringSetting("environment", "GO_ENVIRONMENT", "running environment (production enables json logs)", func(c *Config) *string {
+		return &c.Environment
+	}),
+	stringSetting("server.address", "SERVER_ADDRESS", "address the api listens on", func(c *Config) *string {
+		return &c.Server.Address
+	}),
+	durationSetting("server.read_timeout", "SERVER_READ_TIMEOUT", "maximum duration for reading a whole request", func(c *Config) *Duration {
+		return &c.Server.ReadTimeout
+	}),
+	durationSetting("server.read_header_timeout", "SERVER_READ_HEADER_TIMEOUT", "maximum duration for reading request headers", func(c *Config) *Duration {
+		return &c.Server.ReadHeaderTimeout
+	}),
+	durationSetting("server.write_timeout", "SERVER_WRITE_TIMEOUT", "maximum duration before timing out writes of the response", func(c *Config) *Duration {
+		return &c.Server.WriteTimeout
+	}),
+	durationSetting("server.idle_timeout", "SERVER_IDLE_TIMEOUT", "maximum time to wait for the next request on a keep-alive connection", func(c *Config) *Duration {
+		return &c.Server.IdleTimeout
+	}),
+	intSetting("server.max_header_bytes", "SERVER_MAX_HEADER_BYTES", "maximum size of request headers", func(c *Config) *int {
+		return &c.Server.MaxHeaderBytes
+	}),
+	durationSetting("server.shutdown_timeout", "SERVER_SHUTDOWN_TIMEOUT", "time given to in-flight requests to finish on shutdown", func(c *Config) *Duration {
+		return &c.Server.ShutdownTimeout
+	}),
+	stringSetting("server.tls.cert_file", "SERVER_TLS_CERT_FILE", "certificate served by the api, enables https", func(c *Config) *string {
+		return &c.Server.TLS.CertFile
+	}),
+	stringSetting("server.tls.key_file", "SERVER_TLS_KEY_FILE", "private key of server.tls.cert_file", func(c *Config) *string {
+		return &c.Server.TLS.KeyFile
+	}),
+	stringSetting("server.tls.client_ca_file", "SERVER_TLS_CLIENT_CA_FILE", "CA bundle used to verify client certificates", func(c *Config) *string {
+		return &c.Server.TLS.ClientCAFile
+	}),
+	stringSetting("server.tls.client_auth", "SERVER_TLS_CLIENT_AUTH", "client certificate policy (none, optional, require)", func(c *Config) *string {
+		return &c.Server.TLS.ClientAuth
+	}),
+	stringSetting("admin.token", "SECRET_ADMIN_TOKEN", "bearer token required by the admin endpoints, empty disables them", func(c *Config) *string {
+		return &c.Admin.Token
+	}).hidden(),
+	stringSetting("github.base_url", "GITHUB_BASE_URL", "base url of the github api", func(c *Config) *string {
+		return &c.Github.BaseURL
+	}).runtime(),
+	durationSetting("github.timeout", "GITHUB_TIMEOUT", "timeout of every call to the github api", func(c *Config) *Duration {
+		return &c.Github.Timeout
+	}).runtime(),
+	intSetting("github.max_concurrency", "GITHUB_MAX_CONCURRENCY", "maximum number of repositories created at the same time", func(c *Config) *int {
+		return &c.Github.MaxConcurrency
+	}).runtime(),
+	intSetting("github.max_response_bytes", "GITHUB_MAX_RESPONSE_BYTES", "largest json body decoded from github", func(c *Config) *int {
+		return &c.Github.MaxResponseBytes
+	}).runtime(),
+	intSetting("github.retry.max_attempts", "GITHUB_RETRY_MAX_ATTEMPTS", "attempts made for a failed call to the github api, 1 disables the retries", func(c *Config) *int {
+		return &c.Github.Retry.MaxAttempts
+	}).runtime(),
+	durationSetting("github.retry.initial_backoff", "GITHUB_RETRY_INITIAL_BACKOFF", "wait before the first retry, doubled on every attempt", func(c *Config) *Duration {
+		return &c.Github.Retry.InitialBackoff
+	}).runtime(),
+	durationSetting("github.retry.max_backoff", "GITHUB_RETRY_MAX_BACKOFF", "longest wait between two attempts", func(c *Config) *Duration {
+		return &c.Github.Retry.MaxBackoff
+	}).runtime(),
+	boolSetting("github.circuit_breaker.enabled", "GITHUB_CIRCUIT_BREAKER_ENABLED", "fail fast when a host keeps failing", func(c *Config) *bool {
+		return &c.Github.CircuitBreaker.Enabled
+	}).runtime(),
+	floatSetting("github.circuit_breaker.failure_ratio", "GITHUB_CIRCUIT_BREAKER_FAILURE_RATIO", "ratio of failed calls within a window that opens the breaker", func(c *Config) *float64 {
+		return &c.Github.CircuitBreaker.FailureRatio
+	}).runtime(),
+	intSetting("github.circuit_breaker.min_requests", "GITHUB_CIRCUIT_BREAKER_MIN_REQUESTS", "calls needed within a window before the breaker can open", func(c *Config) *int {
+		return &c.Github.CircuitBreaker.MinRequests
+	}).runtime(),
+	durationSetting("github.circuit_breaker.window", "GITHUB_CIRCUIT_BREAKER_WINDOW", "period over which calls and failures are counted", func(c *Config) *Duration {
+		return &c.Github.CircuitBreaker.Window
+	}).runtime(),
+	durationSetting("github.circuit_breaker.cool_down", "GITHUB_CIRCUIT_BREAKER_COOL_DOWN", "time the breaker stays open before trial calls are sent", func(c *Config) *Duration {
+		return &c.Github.CircuitBreaker.CoolDown
+	}).runtime(),
+	intSetting("github.circuit_breaker.half_open_requests", "GITHUB_CIRCUIT_BREAKER_HALF_OPEN_REQUESTS", "trial calls that must succeed to close the breaker", func(c *Config) *int {
+		return &c.Github.CircuitBreaker.HalfOpenRequests
+	}).runtime(),
+	boolSetting("github.rate_limit.enabled", "GITHUB_RATE_LIMIT_ENABLED", "throttle the calls following the X-RateLimit headers", func(c *Config) *bool {
+		return &c.Github.RateLimit.Enabled
+	}).runtime(),
+	floatSetting("github.rate_limit.requests_per_second", "GITHUB_RATE_LIMIT_REQUESTS_PER_SECOND", "calls sent per second to a host", func(c *Config) *float64 {
+		return &c.Github.RateLimit.RequestsPerSecond
+	}).runtime(),
+	intSetting("github.rate_limit.burst", "GITHUB_RATE_LIMIT_BURST", "calls that can be sent at once to a host", func(c *Config) *int {
+		return &c.Github.RateLimit.Burst
+	}).runtime(),
+	stringSetting("github.rate_limit.on_exhausted", "GITHUB_RATE_LIMIT_ON_EXHAUSTED", "what calls do when the quota is exhausted (wait, fail)", func(c *Config) *string {
+		return &c.Github.RateLimit.OnExhausted
+	}).runtime(),
+	durationSetting("github.rate_limit.max_wait", "GITHUB_RATE_LIMIT_MAX_WAIT", "longest wait for the quota reset before failing", func(c *Config) *Duration {
+		return &c.Github.RateLimit.MaxWait
+	}).runtime(),
+	boolSetting("github.cache.enabled", "GITHUB_CACHE_ENABLED", "cache GET responses and revalidate them with If-None-Match", func(c *Config) *bool {
+		return &c.Github.Cache.Enabled
+	}).runtime(),
+	intSetting("github.cache.max_entries", "GITHUB_CACHE_MAX_ENTRIES", "responses kept by the in-memory cache", func(c *Config) *int {
+		return &c.Github.Cache.MaxEntries
+	}).runtime(),
+	intSetting("github.cache.max_body_bytes", "GITHUB_CACHE_MAX_BODY_BYTES", "largest response body cached", func(c *Config) *int {
+		return &c.Github.Cache.MaxBodyBytes
+	}).runtime(),
+	durationSetting("github.transport.dial_timeout", "GITHUB_TRANSPORT_DIAL_TIMEOUT", "timeout of the connections to github", func(c *Config) *Duration {
+		return &c.Github.Transport.DialTimeout
+	}),
+	durationSetting("github.transport.tls_handshake_timeout", "GITHUB_TRANSPORT_TLS_HANDSHAKE_TIMEOUT", "timeout of the tls handshakes with github", func(c *Config) *Duration {
+		return &c.Github.Transport.TLSHandshakeTimeout
+	}),
+	intSetting("github.transport.max_idle_conns_per_host", "GITHUB_TRANSPORT_MAX_IDLE_CONNS_PER_HOST", "idle connections kept open to every host", func(c *Config) *int {
+		return &c.Github.Transport.MaxIdleConnsPerHost
+	}),
+	durationSetting("github.transport.idle_conn_timeout", "GITHUB_TRANSPORT_IDLE_CONN_TIMEOUT", "time an idle connection is kept open", func(c *Config) *Duration {
+		return &c.Github.Transport.IdleConnTimeout
+	}),
+	boolSetting("github.transport.http2", "GITHUB_TRANSPORT_HTTP2", "use http2 with the hosts supporting it", func(c *Config) *bool {
+		return &c.Github.Transport.HTTP2
+	}),
+	stringSetting("github.transport.proxy", "GITHUB_TRANSPORT_PROXY", "proxy of the calls to github, HTTP_PROXY and HTTPS_PROXY when empty", func(c *Config) *string {
+		return &c.Github.Transport.Proxy
+	}),
+	stringSetting("github.transport.no_proxy", "GITHUB_TRANSPORT_NO_PROXY", "hosts called without github.transport.proxy, NO_PROXY when empty", func(c *Config) *string {
+		return &c.Github.Transport.NoProxy
+	}),
+	stringSetting("github.transport.ca_file", "GITHUB_TRANSPORT_CA_FILE", "CA bundle trusted on top of the system roots", func(c *Config) *string {
+		return &c.Github.Transport.CAFile
+	}),
+	stringSetting("github.auth", "GITHUB_AUTH", "how the api authenticates to github (pat, app)", func(c *Config) *string {
+		return &c.Github.Auth
+	}),
+	intSetting("github.app.id", "GITHUB_APP_ID", "id of the github app used when github.auth is app", func(c *Config) *int {
+		return &c.Github.App.ID
+	}),
+	intSetting("github.app.installation_id", "GITHUB_APP_INSTALLATION_ID", "installation of the github app the api acts for", func(c *Config) *int {
+		return &c.Github.App.InstallationID
+	}),
+	stringSetting("github.app.private_key_file", "GITHUB_APP_PRIVATE_KEY_FILE", "pem private key signing the github app jwt", func(c *Config) *string {
+		return &c.Github.App.PrivateKeyFile
+	}),
+	stringSetting("github.app.org", "GITHUB_APP_ORG", "organization the repositories are created in when github.auth is app", func(c *Config) *string {
+		return &c.Github.App.Org
+	}),
+	durationSetting("github.app.refresh_before", "GITHUB_APP_REFRESH_BEFORE", "how long before their expiry installation tokens are refreshed", func(c *Config) *Duration {
+		return &c.Github.App.RefreshBefore
+	}),
+	stringSetting("github.oauth.client_id", "GITHUB_OAUTH_CLIENT_ID", "client id of the github oauth app, enables /auth/github/login", func(c *Config) *string {
+		return &c.Github.OAuth.ClientID
+	}),
+	stringSetting("github.oauth.client_secret", "SECRET_GITHUB_OAUTH_CLIENT_SECRET", "client secret of the github oauth app", func(c *Config) *string {
+		return &c.Github.OAuth.ClientSecret
+	}).hidden(),
+	stringSetting("github.oauth.redirect_url", "GITHUB_OAUTH_REDIRECT_URL", "public url of /auth/github/callback", func(c *Config) *string {
+		return &c.Github.OAuth.RedirectURL
+	}),
+	stringSetting("github.oauth.authorize_url", "GITHUB_OAUTH_AUTHORIZE_URL", "url the users are sent to for logging in to github", func(c *Config) *string {
+		return &c.Github.OAuth.AuthorizeURL
+	}),
+	stringSetting("github.oauth.token_url", "GITHUB_OAUTH_TOKEN_URL", "url exchanging the oauth codes for tokens", func(c *Config) *string {
+		return &c.Github.OAuth.TokenURL
+	}),
+	listSetting("github.oauth.scopes", "GITHUB_OAUTH_SCOPES", "comma separated scopes requested to the users", func(c *Config) *[]string {
+		return &c.Github.OAuth.Scopes
+	}),
+	durationSetting("github.oauth.login_ttl", "GITHUB_OAUTH_LOGIN_TTL", "time given to the users to complete a login", func(c *Config) *Duration {
+		return &c.Github.OAuth.LoginTTL
+	}),
+	durationSetting("github.oauth.session_ttl", "GITHUB_OAUTH_SESSION_TTL", "how long the token of a logged in user is used", func(c *Config) *Duration {
+		return &c.Github.OAuth.SessionTTL
+	}),
+	stringSetting("github.token.provider", "GITHUB_TOKEN_PROVIDER", "where the github token is read from (env, file, encrypted_file)", func(c *Config) *string {
+		return &c.Github.Token.Provider
+	}),
+	stringSetting("github.token.env", "GITHUB_TOKEN_ENV", "environment variable holding the github token", func(c *Config) *string {
+		return &c.Github.Token.Env
+	}),
+	stringSetting("github.token.file", "GITHUB_TOKEN_FILE", "file holding the (possibly encrypted) github token", func(c *Config) *string {
+		return &c.Github.Token.File
+	}),
+	stringSetting("github.token.key", "SECRET_GITHUB_TOKEN_KEY", "base64 AES key used to decrypt github.token.file", func(c *Config) *string {
+		return &c.Github.Token.Key
+	}).hidden(),
+	stringSetting("log.level", "LOG_LEVEL", "log level (debug, info, warn, error)", func(c *Config) *string {
+		return &c.Log.Level
+	}).runtime(),
+	stringSetting("log.backend", "LOG_BACKEND", "logging library used by the api (zap, logrus)", func(c *Config) *string {
+		return &c.Log.Backend
+	}).runtime(),
+	stringSetting("tracing.exporter", "TRACING_EXPORTER", "where traces are sent (none, otlp, stdout, file)", func(c *Config) *string {
+		return &c.Tracing.Exporter
+	}),
+	stringSetting("tracing.service_name", "TRACING_SERVICE_NAME", "service name reported in traces", func(c *Config) *string {
+		return &c.Tracing.ServiceName
+	}),
+	stringSetting("tracing.otlp_endpoint", "TRACING_OTLP_ENDPOINT", "host:port of the OTLP/HTTP collector", func(c *Config) *string {
+		return &c.Tracing.OTLPEndpoint
+	}),
+	boolSetting("tracing.otlp_insecure", "TRACING_OTLP_INSECURE", "send traces to the collector over plain http", func(c *Config) *bool {
+		return &c.Tracing.OTLPInsecure
+	}),
+	stringSetting("tracing.file", "TRACING_FILE", "file the traces are written to by the file exporter", func(c *Config) *string {
+		return &c.Tracing.File
+	}),
+	floatSetting("tracing.sample_ratio", "TRACING_SAMPLE_RATIO", "ratio of new traces that are sampled, from 0 to 1", func(c *Config) *float64 {
+		return &c.Tracing.SampleRatio
+	}),
+	boolSetting("access_log.enabled", "ACCESS_LOG_ENABLED", "write one log event per request", func(c *Config) *bool {
+		return &c.AccessLog.Enabled
+	}).runtime(),
+	listSetting("access_log.redact_headers", "ACCESS_LOG_REDACT_HEADERS", "comma separated request headers whose values are redacted", func(c *Config) *[]string {
+		return &c.AccessLog.RedactHeaders
+	}).runtime(),
+	listSetting("access_log.redact_fields", "ACCESS_LOG_REDACT_FIELDS", "comma separated json body fields whose values are redacted", func(c *Config) *[]string {
+		return &c.AccessLog.RedactFields
+	}).runtime(),
+	boolSetting("access_log.log_body", "ACCESS_LOG_LOG_BODY", "include the (redacted) json request body", func(c *Config) *bool {
+		return &c.AccessLog.LogBody
+	}).runtime(),
+	intSetting("access_log.max_body_bytes", "ACCESS_LOG_MAX_BODY_BYTES", "request bodies larger than this are not logged", func(c *Config) *int {
+		return &c.AccessLog.MaxBodyBytes
+	}).runtime(),
+	ratesSetting("access_log.sample_rates", "ACCESS_LOG_SAMPLE_RATES", "comma separated route=ratio pairs of successful requests that are logged", func(c *Config) *map[string]float64 {
+		return &c.AccessLog.SampleRates
+	}).runtime(),
+	boolSetting("fault_injection.enabled", "FAULT_INJECTION_ENABLED", "inject fault_injection.faults in the calls to github, refused in production", func(c *Config) *bool {
+		return &c.Faults.Enabled
+	}).runtime(),
+	faultsSetting("fault_injection.faults", "FAULT_INJECTION_FAULTS", "json array of faults (host, path, percent, delay, status, error)", func(c *Config) *[]FaultConfig {
+		return &c.Faults.Faults
+	}).runtime(),
+}
+
+func findSetting(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.key == key {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+//Duration is a time.Duration written as "10s" or "1m30s" in config files.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var value string
+	if err := json.Unmarshal(b, &value); err != nil {
+		return fmt.Errorf("invalid duration %s", string(b))
+	}
+	return d.parse(value)
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	return d.parse(value)
+}
+
+func (d *Duration) parse(value string) error {
+	parsed, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", value)
+	}
+	d.Duration = parsed
+	return nil
+}
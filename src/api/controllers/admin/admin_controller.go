@@ -0,0 +1,107 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jebo87/golang-microservices/src/api/clients/restclient"
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/jebo87/golang-microservices/src/api/middlewares"
+	"github.com/jebo87/golang-microservices/src/api/utils/errors"
+)
+
+const (
+	headerAuthorization = "Authorization"
+	bearerPrefix        = "Bearer "
+)
+
+type UpdateConfigResponse struct {
+	Changes []config.Change `json:"changes"`
+}
+
+//Authenticate only lets through requests carrying the configured admin token.
+//The admin endpoints are disabled when no token is configured.
+func Authenticate(c *gin.Context) {
+	expected := config.Get().Admin.Token
+	if expected == "" {
+		apiErr := errors.NewNotFoundApiError("admin endpoints are disabled")
+		c.AbortWithStatusJSON(apiErr.Status(), errors.WithRequestID(apiErr, middlewares.GetRequestID(c)))
+		return
+	}
+
+	header := c.GetHeader(headerAuthorization)
+	given := strings.TrimPrefix(header, bearerPrefix)
+	if !strings.HasPrefix(header, bearerPrefix) || subtle.ConstantTimeCompare([]byte(given), []byte(expected)) != 1 {
+		apiErr := errors.NewUnauthorizedError("invalid admin token")
+		c.AbortWithStatusJSON(apiErr.Status(), errors.WithRequestID(apiErr, middlewares.GetRequestID(c)))
+		return
+	}
+	c.Next()
+}
+
+func GetConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, config.Values())
+}
+
+//GetCircuitBreakers lists the state of the circuit breaker of every upstream host.
+func GetCircuitBreakers(c *gin.Context) {
+	c.JSON(http.StatusOK, restclient.GetBreakerStates())
+}
+
+func UpdateConfig(c *gin.Context) {
+	var request map[string]string
+	if err := c.ShouldBindJSON(&request); err != nil || len(request) == 0 {
+		apiErr := errors.NewBadRequestError("invalid json body")
+		c.JSON(apiErr.Status(), errors.WithRequestID(apiErr, middlewares.GetRequestID(c)))
+		return
+	}
+
+	changes, err := config.Update(request)
+	if err != nil {
+		apiErr := errors.NewBadRequestError(err.Error())
+		c.JSON(apiErr.Status(), errors.WithRequestID(apiErr, middlewares.GetRequestID(c)))
+		return
+	}
+	c.JSON(http.StatusOK, UpdateConfigResponse{Changes: changes})
+}
+
+//GetFaults shows the faults injected in the calls to github.
+func GetFaults(c *gin.Context) {
+	c.JSON(http.StatusOK, config.Get().Faults)
+}
+
+//UpdateFaults replaces the faults injected in the calls to github. They go
+//through config.Update, which refuses to enable them in production.
+func UpdateFaults(c *gin.Context) {
+	var request config.FaultsConfig
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apiErr := errors.NewBadRequestError("invalid json body")
+		c.JSON(apiErr.Status(), errors.WithRequestID(apiErr, middlewares.GetRequestID(c)))
+		return
+	}
+
+	faults := ""
+	if len(request.Faults) > 0 {
+		encoded, err := json.Marshal(request.Faults)
+		if err != nil {
+			apiErr := errors.NewBadRequestError("invalid json body")
+			c.JSON(apiErr.Status(), errors.WithRequestID(apiErr, middlewares.GetRequestID(c)))
+			return
+		}
+		faults = string(encoded)
+	}
+	changes, err := config.Update(map[string]string{
+		"fault_injection.enabled": strconv.FormatBool(request.Enabled),
+		"fault_injection.faults":  faults,
+	})
+	if err != nil {
+		apiErr := errors.NewBadRequestError(err.Error())
+		c.JSON(apiErr.Status(), errors.WithRequestID(apiErr, middlewares.GetRequestID(c)))
+		return
+	}
+	c.JSON(http.StatusOK, UpdateConfigResponse{Changes: changes})
+}
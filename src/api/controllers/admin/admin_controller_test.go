@@ -0,0 +1,161 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/clients/restclient"
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/jebo87/golang-microservices/src/api/utils/errors"
+	"github.com/jebo87/golang-microservices/src/api/utils/test_utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func withAdminToken(t *testing.T, token string) {
+	previous := config.Get()
+	cfg := config.Default()
+	cfg.Admin.Token = token
+	config.Set(cfg)
+	t.Cleanup(func() { config.Set(previous) })
+}
+
+func TestAuthenticateDisabled(t *testing.T) {
+	withAdminToken(t, "")
+	response := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/admin/config", nil)
+	c := test_utils.GetMockedContext(request, response)
+
+	Authenticate(c)
+
+	assert.True(t, c.IsAborted())
+	assert.EqualValues(t, http.StatusNotFound, response.Code)
+}
+
+func TestAuthenticateInvalidToken(t *testing.T) {
+	withAdminToken(t, "s3cr3t")
+	response := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/admin/config", nil)
+	request.Header.Set("Authorization", "Bearer wrong")
+	c := test_utils.GetMockedContext(request, response)
+
+	Authenticate(c)
+
+	assert.True(t, c.IsAborted())
+	apiErr, err := errors.NewApiErrFromBytes(response.Body.Bytes())
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusUnauthorized, apiErr.Status())
+	assert.EqualValues(t, "invalid admin token", apiErr.Message())
+}
+
+func TestAuthenticateValidToken(t *testing.T) {
+	withAdminToken(t, "s3cr3t")
+	response := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/admin/config", nil)
+	request.Header.Set("Authorization", "Bearer s3cr3t")
+	c := test_utils.GetMockedContext(request, response)
+
+	Authenticate(c)
+
+	assert.False(t, c.IsAborted())
+}
+
+func TestGetConfigMasksSecrets(t *testing.T) {
+	withAdminToken(t, "s3cr3t")
+	response := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/admin/config", nil)
+	c := test_utils.GetMockedContext(request, response)
+
+	GetConfig(c)
+
+	assert.EqualValues(t, http.StatusOK, response.Code)
+	assert.NotContains(t, response.Body.String(), "s3cr3t")
+	var values map[string]string
+	assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &values))
+	assert.EqualValues(t, "info", values["log.level"])
+}
+
+func TestUpdateConfig(t *testing.T) {
+	withAdminToken(t, "s3cr3t")
+	response := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPatch, "/admin/config", strings.NewReader(`{"log.level":"debug"}`))
+	c := test_utils.GetMockedContext(request, response)
+
+	UpdateConfig(c)
+
+	assert.EqualValues(t, http.StatusOK, response.Code)
+	var result UpdateConfigResponse
+	assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &result))
+	assert.EqualValues(t, 1, len(result.Changes))
+	assert.EqualValues(t, "log.level", result.Changes[0].Key)
+	assert.EqualValues(t, "debug", config.Get().Log.Level)
+}
+
+func TestUpdateConfigInvalidValue(t *testing.T) {
+	withAdminToken(t, "s3cr3t")
+	response := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPatch, "/admin/config", strings.NewReader(`{"log.level":"loud"}`))
+	c := test_utils.GetMockedContext(request, response)
+
+	UpdateConfig(c)
+
+	apiErr, err := errors.NewApiErrFromBytes(response.Body.Bytes())
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, apiErr.Status())
+	assert.Contains(t, apiErr.Message(), "log.level")
+}
+
+func TestGetCircuitBreakers(t *testing.T) {
+	restclient.ResetBreakers()
+	response := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/admin/circuit_breakers", nil)
+	c := test_utils.GetMockedContext(request, response)
+
+	GetCircuitBreakers(c)
+
+	assert.EqualValues(t, http.StatusOK, response.Code)
+	var states []restclient.BreakerState
+	assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &states))
+	assert.EqualValues(t, 0, len(states))
+}
+
+func TestUpdateFaults(t *testing.T) {
+	withAdminToken(t, "s3cr3t")
+	response := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPut, "/admin/faults", strings.NewReader(`{"enabled":true,"faults":[{"host":"api.github.com","percent":50,"delay":"1s","status":503}]}`))
+	c := test_utils.GetMockedContext(request, response)
+
+	UpdateFaults(c)
+
+	assert.EqualValues(t, http.StatusOK, response.Code)
+	faults := config.Get().Faults
+	assert.True(t, faults.Enabled)
+	assert.EqualValues(t, []config.FaultConfig{{Host: "api.github.com", Percent: 50, Delay: config.Duration{Duration: time.Second}, Status: 503}}, faults.Faults)
+
+	response = httptest.NewRecorder()
+	GetFaults(test_utils.GetMockedContext(httptest.NewRequest(http.MethodGet, "/admin/faults", nil), response))
+	var shown config.FaultsConfig
+	assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &shown))
+	assert.EqualValues(t, faults, shown)
+}
+
+func TestUpdateFaultsRefusedInProduction(t *testing.T) {
+	withAdminToken(t, "s3cr3t")
+	cfg := config.Get()
+	cfg.Environment = "production"
+	config.Set(cfg)
+	response := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPut, "/admin/faults", strings.NewReader(`{"enabled":true,"faults":[{"percent":100,"error":"connection reset"}]}`))
+	c := test_utils.GetMockedContext(request, response)
+
+	UpdateFaults(c)
+
+	apiErr, err := errors.NewApiErrFromBytes(response.Body.Bytes())
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, apiErr.Status())
+	assert.Contains(t, apiErr.Message(), "fault_injection.enabled: can not be enabled in production")
+	assert.False(t, config.Get().Faults.Enabled)
+}
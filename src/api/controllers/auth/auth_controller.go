@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/jebo87/golang-microservices/src/api/middlewares"
+	"github.com/jebo87/golang-microservices/src/api/services"
+	"github.com/jebo87/golang-microservices/src/api/sessions"
+	"github.com/jebo87/golang-microservices/src/api/utils/errors"
+)
+
+const (
+	//stateCookie binds a login to the browser that started it.
+	stateCookie = "github_oauth_state"
+	statePath   = "/auth/github"
+)
+
+type LoginResponse struct {
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+//Login sends the user to github to authorize the api.
+func Login(c *gin.Context) {
+	authorizeURL, state, err := services.LoginService.Start(c.Request.Context())
+	if err != nil {
+		c.JSON(err.Status(), errors.WithRequestID(err, middlewares.GetRequestID(c)))
+		return
+	}
+	setCookie(c, stateCookie, state, statePath, config.Get().Github.OAuth.LoginTTL.Duration)
+	c.Redirect(http.StatusFound, authorizeURL)
+}
+
+//Callback receives the user back from github and starts a session holding
+//the token of the user, used by the later repository calls.
+func Callback(c *gin.Context) {
+	if reason := c.Query("error"); reason != "" {
+		apiErr := errors.NewBadRequestError("github login refused: " + reason)
+		c.JSON(apiErr.Status(), errors.WithRequestID(apiErr, middlewares.GetRequestID(c)))
+		return
+	}
+	state := c.Query("state")
+	expected, _ := c.Cookie(stateCookie)
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(expected)) != 1 {
+		apiErr := errors.NewBadRequestError("invalid oauth state")
+		c.JSON(apiErr.Status(), errors.WithRequestID(apiErr, middlewares.GetRequestID(c)))
+		return
+	}
+	setCookie(c, stateCookie, "", statePath, -1)
+
+	id, session, err := services.LoginService.Complete(c.Request.Context(), state, c.Query("code"))
+	if err != nil {
+		c.JSON(err.Status(), errors.WithRequestID(err, middlewares.GetRequestID(c)))
+		return
+	}
+	setCookie(c, sessions.CookieName, id, "/", time.Until(session.ExpiresAt))
+	c.JSON(http.StatusOK, LoginResponse{ExpiresAt: session.ExpiresAt})
+}
+
+//setCookie sets a cookie hidden from scripts, only sent over https when the
+//api is served over https. A negative maxAge deletes it.
+func setCookie(c *gin.Context, name string, value string, path string, maxAge time.Duration) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   int(maxAge / time.Second),
+		Secure:   c.Request.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(c.Writer, cookie)
+}
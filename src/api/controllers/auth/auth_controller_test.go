@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/jebo87/golang-microservices/src/api/sessions"
+	"github.com/jebo87/golang-microservices/src/api/utils/errors"
+	"github.com/jebo87/golang-microservices/src/api/utils/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+const redirectURL = "https://api.example.com/auth/github/callback"
+
+func useOAuthServer(t *testing.T) *mocks.OAuthServer {
+	server := mocks.NewOAuthServer("client-id", "client-secret")
+	previous := config.Get()
+	cfg := config.Default()
+	cfg.Github.OAuth.ClientID = server.ClientID
+	cfg.Github.OAuth.ClientSecret = server.ClientSecret
+	cfg.Github.OAuth.RedirectURL = redirectURL
+	cfg.Github.OAuth.AuthorizeURL = server.AuthorizeURL()
+	cfg.Github.OAuth.TokenURL = server.TokenURL()
+	config.Set(cfg)
+	t.Cleanup(func() {
+		config.Set(previous)
+		server.Close()
+	})
+	return server
+}
+
+func authRouter() *gin.Engine {
+	router := gin.New()
+	router.GET("/auth/github/login", Login)
+	router.GET("/auth/github/callback", Callback)
+	return router
+}
+
+//login starts a login and lets the fake server approve it, returning the
+//callback request github would send the browser to.
+func login(t *testing.T, router *gin.Engine) *http.Request {
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/auth/github/login", nil))
+	assert.EqualValues(t, http.StatusFound, response.Code)
+	authorize, _ := url.Parse(response.Header().Get("Location"))
+	assert.EqualValues(t, "repo", authorize.Query().Get("scope"))
+	assert.EqualValues(t, redirectURL, authorize.Query().Get("redirect_uri"))
+
+	browser := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	approved, err := browser.Get(authorize.String())
+	assert.Nil(t, err)
+	approved.Body.Close()
+	callback, _ := url.Parse(approved.Header.Get("Location"))
+	assert.True(t, strings.HasPrefix(callback.String(), redirectURL))
+
+	request := httptest.NewRequest(http.MethodGet, "/auth/github/callback?"+callback.RawQuery, nil)
+	for _, cookie := range response.Result().Cookies() {
+		assert.True(t, cookie.HttpOnly)
+		request.AddCookie(cookie)
+	}
+	return request
+}
+
+func TestLoginStoresTheTokenInASession(t *testing.T) {
+	useOAuthServer(t)
+	router := authRouter()
+	callback := login(t, router)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, callback)
+
+	assert.EqualValues(t, http.StatusOK, response.Code)
+	assert.NotContains(t, response.Body.String(), "gho_fake")
+	var result LoginResponse
+	assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &result))
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range response.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	assert.EqualValues(t, -1, cookies[stateCookie].MaxAge)
+	session, ok := sessions.Default.Get(cookies[sessions.CookieName].Value)
+	assert.True(t, ok)
+	assert.EqualValues(t, "gho_fake_1", session.GithubToken)
+	assert.EqualValues(t, result.ExpiresAt.Unix(), session.ExpiresAt.Unix())
+
+	//a state can only be used once
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, callback)
+	apiErr, err := errors.NewApiErrFromBytes(response.Body.Bytes())
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, apiErr.Status())
+	assert.EqualValues(t, "unknown or expired github login, log in again", apiErr.Message())
+}
+
+func TestCallbackFromAnotherBrowser(t *testing.T) {
+	useOAuthServer(t)
+	router := authRouter()
+	callback := login(t, router)
+	//the state cookie of the browser that started the login is missing
+	callback.Header.Del("Cookie")
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, callback)
+
+	apiErr, err := errors.NewApiErrFromBytes(response.Body.Bytes())
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, apiErr.Status())
+	assert.EqualValues(t, "invalid oauth state", apiErr.Message())
+}
+
+func TestCallbackRejectedByGithub(t *testing.T) {
+	server := useOAuthServer(t)
+	router := authRouter()
+	callback := login(t, router)
+	//the fake server rejects the exchange as github does for a bad client
+	server.ClientSecret = "rotated"
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, callback)
+
+	apiErr, err := errors.NewApiErrFromBytes(response.Body.Bytes())
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, apiErr.Status())
+	assert.EqualValues(t, "invalid github oauth code: The client_id and/or client_secret passed are incorrect.", apiErr.Message())
+}
+
+func TestLoginDisabled(t *testing.T) {
+	response := httptest.NewRecorder()
+	authRouter().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/auth/github/login", nil))
+
+	assert.EqualValues(t, http.StatusNotFound, response.Code)
+}
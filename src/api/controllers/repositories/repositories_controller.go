@@ -2,24 +2,54 @@ package repositories
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jebo87/golang-microservices/src/api/domain/repositories"
+	"github.com/jebo87/golang-microservices/src/api/middlewares"
 	"github.com/jebo87/golang-microservices/src/api/services"
+	"github.com/jebo87/golang-microservices/src/api/sessions"
 	"github.com/jebo87/golang-microservices/src/api/utils/errors"
 )
 
+const (
+	headerAuthorization = "Authorization"
+	headerGithubToken   = "X-GitHub-Token"
+)
+
+//githubToken returns the github token of the caller, sent in X-GitHub-Token
+//or as the token or Bearer credentials of Authorization, or else obtained by
+//the github login of its session. It is empty when the repositories are
+//created with the token of the server.
+func githubToken(c *gin.Context) string {
+	if token := strings.TrimSpace(c.GetHeader(headerGithubToken)); token != "" {
+		return token
+	}
+	authorization := c.GetHeader(headerAuthorization)
+	for _, scheme := range []string{"token ", "Bearer "} {
+		if len(authorization) > len(scheme) && strings.EqualFold(authorization[:len(scheme)], scheme) {
+			return strings.TrimSpace(authorization[len(scheme):])
+		}
+	}
+	if id, err := c.Cookie(sessions.CookieName); err == nil {
+		if session, ok := sessions.Default.Get(id); ok {
+			return session.GithubToken
+		}
+	}
+	return ""
+}
+
 func CreateRepo(c *gin.Context) {
 	var request repositories.CreateRepoRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
 		apiErr := errors.NewBadRequestError("invalid json body")
-		c.JSON(apiErr.Status(), apiErr)
+		c.JSON(apiErr.Status(), errors.WithRequestID(apiErr, middlewares.GetRequestID(c)))
 		return
 	}
 
-	result, err := services.RepositoryService.CreateRepo(request)
+	result, err := services.RepositoryService.CreateRepo(c.Request.Context(), githubToken(c), request)
 	if err != nil {
-		c.JSON(err.Status(), err)
+		c.JSON(err.Status(), errors.WithRequestID(err, middlewares.GetRequestID(c)))
 		return
 	}
 	c.JSON(http.StatusCreated, result)
@@ -29,11 +59,16 @@ func CreateRepos(c *gin.Context) {
 	var request []repositories.CreateRepoRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
 		apiErr := errors.NewBadRequestError("invalid json body")
-		c.JSON(apiErr.Status(), apiErr)
+		c.JSON(apiErr.Status(), errors.WithRequestID(apiErr, middlewares.GetRequestID(c)))
+		return
+	}
+	if len(request) == 0 {
+		apiErr := errors.NewBadRequestError("no repositories to create")
+		c.JSON(apiErr.Status(), errors.WithRequestID(apiErr, middlewares.GetRequestID(c)))
 		return
 	}
 
-	result := services.RepositoryService.CreateRepos(request)
+	result := services.RepositoryService.CreateRepos(c.Request.Context(), githubToken(c), request)
 
 	c.JSON(result.StatusCode, result)
 }
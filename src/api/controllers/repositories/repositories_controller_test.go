@@ -2,15 +2,18 @@ package repositories
 
 import (
 	"encoding/json"
-	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jebo87/golang-microservices/src/api/clients/restclient"
 	"github.com/jebo87/golang-microservices/src/api/domain/repositories"
+	"github.com/jebo87/golang-microservices/src/api/middlewares"
+	"github.com/jebo87/golang-microservices/src/api/secrets"
+	"github.com/jebo87/golang-microservices/src/api/sessions"
 	"github.com/jebo87/golang-microservices/src/api/utils/errors"
 	"github.com/jebo87/golang-microservices/src/api/utils/mocks"
 	"github.com/jebo87/golang-microservices/src/api/utils/test_utils"
@@ -18,11 +21,19 @@ import (
 )
 
 func TestMain(m *testing.M) {
-	restclient.StartMockups()
+	secrets.GithubToken = secrets.NewStaticProvider("test-token")
 	os.Exit(m.Run())
 }
 
+//useTransport makes request send its calls to a fake github owned by the test,
+//with their own breakers, rate limiters and cache.
+func useTransport(request *http.Request) (*mocks.Transport, *http.Request) {
+	transport := mocks.NewTransport()
+	return transport, request.WithContext(restclient.ContextWithClient(request.Context(), transport))
+}
+
 func TestCreateRepoInvalidJsonRequest(t *testing.T) {
+	t.Parallel()
 	response := httptest.NewRecorder()
 	request, _ := http.NewRequest("POST", "/repositories", strings.NewReader(``))
 	c := test_utils.GetMockedContext(request, response)
@@ -39,18 +50,45 @@ func TestCreateRepoInvalidJsonRequest(t *testing.T) {
 	assert.EqualValues(t, "invalid json body", apiErr.Message())
 }
 
+func TestCreateRepoInvalidJsonRequestEchoesRequestID(t *testing.T) {
+	t.Parallel()
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/repository", strings.NewReader(``))
+	request.Header.Set("X-Request-ID", "abc-123")
+	c := test_utils.GetMockedContext(request, response)
+
+	middlewares.RequestID(c)
+	CreateRepo(c)
+
+	assert.EqualValues(t, "abc-123", response.Header().Get("X-Request-ID"))
+	apiErr, err := errors.NewApiErrFromBytes(response.Body.Bytes())
+	assert.Nil(t, err)
+	assert.EqualValues(t, "abc-123", apiErr.RequestID())
+}
+
+func TestCreateReposForwardsRequestID(t *testing.T) {
+	t.Parallel()
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/repositories", strings.NewReader(`[{"name":"one"},{"name":"two"}]`))
+	transport, request := useTransport(request)
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/user/repos")).
+		Respond(http.StatusCreated, `{"id": 123,"name": "testing","owner":{"login":"jebo87"}}`)
+	request.Header.Set("X-Request-ID", "batch-42")
+	c := test_utils.GetMockedContext(request, response)
+
+	middlewares.RequestID(c)
+	CreateRepos(c)
+
+	assert.EqualValues(t, http.StatusCreated, response.Code)
+	transport.AssertCalled(t, mocks.Match(http.MethodPost, "https://api.github.com/user/repos").Header("X-Request-ID", "batch-42"), 2)
+}
+
 func TestCreateRepoErrorGithub(t *testing.T) {
-	restclient.FlushMockups()
-	restclient.AddMockup(restclient.Mock{
-		Url:        "https://api.github.com/user/repos",
-		HttpMethod: http.MethodPost,
-		Response: &http.Response{
-			StatusCode: http.StatusUnauthorized,
-			Body:       ioutil.NopCloser(strings.NewReader(`{"message": "Requires authentication","documentation_url": "https://docs.github.com/rest/reference/repos#create-a-repository-for-the-authenticated-user"}`)),
-		},
-	})
+	t.Parallel()
 	response := httptest.NewRecorder()
 	request, _ := http.NewRequest("POST", "/repositories", strings.NewReader(`{"name":"test"}`))
+	transport, request := useTransport(request)
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/user/repos")).Respond(http.StatusUnauthorized, `{"message": "Requires authentication","documentation_url": "https://docs.github.com/rest/reference/repos#create-a-repository-for-the-authenticated-user"}`)
 	c := test_utils.GetMockedContext(request, response)
 
 	CreateRepo(c)
@@ -66,17 +104,11 @@ func TestCreateRepoErrorGithub(t *testing.T) {
 }
 
 func TestCreateRepoNoError(t *testing.T) {
-	restclient.FlushMockups()
-	restclient.AddMockup(restclient.Mock{
-		Url:        "https://api.github.com/user/repos",
-		HttpMethod: http.MethodPost,
-		Response: &http.Response{
-			StatusCode: http.StatusCreated,
-			Body:       ioutil.NopCloser(strings.NewReader(`{"id": 123,"name": "golang-example","description":"This is the description","owner":{"login":"jebo87"}}`)),
-		},
-	})
+	t.Parallel()
 	response := httptest.NewRecorder()
 	request, _ := http.NewRequest("POST", "/repositories", strings.NewReader(`{"name":"test"}`))
+	transport, request := useTransport(request)
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/user/repos")).Respond(http.StatusCreated, `{"id": 123,"name": "golang-example","description":"This is the description","owner":{"login":"jebo87"}}`)
 	c := test_utils.GetMockedContext(request, response)
 
 	CreateRepo(c)
@@ -93,19 +125,11 @@ func TestCreateRepoNoError(t *testing.T) {
 }
 
 func TestCreateReposInvalidJson(t *testing.T) {
-	restclient.FlushMockups()
-	restclient.StopMockups()
-	restclient.Client = &mocks.MockClient{}
-
-	mocks.DoFunc = func(req *http.Request) (*http.Response, error) {
-		return &http.Response{
-			StatusCode: http.StatusBadRequest,
-		}, nil
-
-	}
-
+	t.Parallel()
 	response := httptest.NewRecorder()
 	request, _ := http.NewRequest("POST", "/repositories", strings.NewReader(``))
+	transport, request := useTransport(request)
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/user/repos")).Respond(http.StatusBadRequest, ``)
 	c := test_utils.GetMockedContext(request, response)
 	CreateRepos(c)
 	apiErr, err := errors.NewApiErrFromBytes(response.Body.Bytes())
@@ -114,21 +138,20 @@ func TestCreateReposInvalidJson(t *testing.T) {
 	assert.EqualValues(t, "invalid json body", apiErr.Message())
 }
 
-func TestCreateReposSuccess(t *testing.T) {
-	restclient.FlushMockups()
-	restclient.StopMockups()
-	restclient.Client = &mocks.MockClient{}
-
-	mocks.DoFunc = func(req *http.Request) (*http.Response, error) {
-
-		r := ioutil.NopCloser(strings.NewReader(`{"id": 123,"name": "testing","description":"This is the description","owner":{"login":"jebo87"}}`))
+func TestCreateReposEmptyBatch(t *testing.T) {
+	t.Parallel()
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest(http.MethodPost, "/repositories", strings.NewReader(`[]`))
+	CreateRepos(test_utils.GetMockedContext(request, response))
 
-		return &http.Response{
-			StatusCode: 200,
-			Body:       r,
-		}, nil
-	}
+	apiErr, err := errors.NewApiErrFromBytes(response.Body.Bytes())
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, apiErr.Status())
+	assert.EqualValues(t, "no repositories to create", apiErr.Message())
+}
 
+func TestCreateReposSuccess(t *testing.T) {
+	t.Parallel()
 	response := httptest.NewRecorder()
 	request, _ := http.NewRequest("POST", "/repositories", strings.NewReader(`
 	[
@@ -141,6 +164,9 @@ func TestCreateReposSuccess(t *testing.T) {
 			"description": "This is a description"
    		}
 	]`))
+	transport, request := useTransport(request)
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/user/repos")).
+		Respond(http.StatusOK, `{"id": 123,"name": "testing","description":"This is the description","owner":{"login":"jebo87"}}`)
 	c := test_utils.GetMockedContext(request, response)
 	CreateRepos(c)
 	result := repositories.CreateReposResponse{}
@@ -159,3 +185,49 @@ func TestCreateReposSuccess(t *testing.T) {
 	assert.EqualValues(t, "jebo87", result.Results[1].Response.Owner)
 
 }
+
+func TestGithubToken(t *testing.T) {
+	t.Parallel()
+	for headers, expected := range map[[2]string]string{
+		{"", ""}:                          "",
+		{"", "Bearer caller-token"}:       "caller-token",
+		{"", "token caller-token"}:        "caller-token",
+		{"", "Basic dXNlcjpwYXNz"}:        "",
+		{"header-token", "token ignored"}: "header-token",
+	} {
+		request, _ := http.NewRequest(http.MethodPost, "/repository", nil)
+		request.Header.Set("X-GitHub-Token", headers[0])
+		request.Header.Set("Authorization", headers[1])
+		c := test_utils.GetMockedContext(request, httptest.NewRecorder())
+
+		assert.EqualValues(t, expected, githubToken(c), headers)
+	}
+}
+
+func TestGithubTokenFromSession(t *testing.T) {
+	t.Parallel()
+	sessions.Default.Set("session-id", sessions.Session{GithubToken: "gho_session", ExpiresAt: time.Now().Add(time.Hour)})
+	defer sessions.Default.Delete("session-id")
+
+	request, _ := http.NewRequest(http.MethodPost, "/repository", nil)
+	request.AddCookie(&http.Cookie{Name: sessions.CookieName, Value: "session-id"})
+	assert.EqualValues(t, "gho_session", githubToken(test_utils.GetMockedContext(request, httptest.NewRecorder())))
+
+	//a token sent with the request wins over the session
+	request.Header.Set("X-GitHub-Token", "header-token")
+	assert.EqualValues(t, "header-token", githubToken(test_utils.GetMockedContext(request, httptest.NewRecorder())))
+}
+
+func TestCreateReposWithCallerToken(t *testing.T) {
+	t.Parallel()
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest(http.MethodPost, "/repositories", strings.NewReader(`[{"name":"one"},{"name":"two"}]`))
+	transport, request := useTransport(request)
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/user/repos")).
+		RespondJSON(http.StatusCreated, map[string]interface{}{"id": 123, "name": "testing", "owner": map[string]string{"login": "caller"}})
+	request.Header.Set("X-GitHub-Token", "caller-token")
+	CreateRepos(test_utils.GetMockedContext(request, response))
+
+	assert.EqualValues(t, http.StatusCreated, response.Code)
+	transport.AssertCalled(t, mocks.Match(http.MethodPost, "https://api.github.com/user/repos").Header("Authorization", "token caller-token"), 2)
+}
@@ -0,0 +1,184 @@
+package github_provider
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/clients/restclient"
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/jebo87/golang-microservices/src/api/log"
+)
+
+const (
+	pathInstallationToken = "/app/installations/%d/access_tokens"
+
+	//jwtLifetime is below the 10 minutes accepted by github, and jwtSkew
+	//backdates the token in case our clock is ahead of github's.
+	jwtLifetime = 9 * time.Minute
+	jwtSkew     = time.Minute
+)
+
+//now is swapped by tests to expire the cached tokens.
+var now = time.Now
+
+//AppSettings describes the github App the api authenticates as.
+type AppSettings struct {
+	AppID          int64
+	InstallationID int64
+	PrivateKeyFile string
+	//RefreshBefore is how long before their expiry the installation tokens are replaced.
+	RefreshBefore time.Duration
+}
+
+type installationToken struct {
+	mutex     sync.Mutex
+	value     string
+	expiresAt time.Time
+}
+
+//AppAuth authenticates as a github App. It signs a JWT with the private key
+//of the app and exchanges it for installation access tokens, cached for each
+//installation until shortly before they expire.
+type AppAuth struct {
+	settings AppSettings
+	key      *rsa.PrivateKey
+
+	mutex  sync.Mutex
+	tokens map[int64]*installationToken
+}
+
+func NewAppAuth(settings AppSettings) (*AppAuth, error) {
+	data, err := ioutil.ReadFile(settings.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the github app private key: %s", err)
+	}
+	key, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	return &AppAuth{settings: settings, key: key, tokens: make(map[int64]*installationToken)}, nil
+}
+
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("github app private key is not pem encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid github app private key: %s", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("github app private key is not an rsa key")
+	}
+	return key, nil
+}
+
+//Secret returns a token of the configured installation, so AppAuth can
+//replace the personal access token in secrets.GithubToken. It is only used
+//without a request, the calls made for one go through SecretContext.
+func (a *AppAuth) Secret() (string, error) {
+	return a.Token(context.Background())
+}
+
+//SecretContext makes AppAuth a secrets.ContextSecretProvider, the token is
+//requested with the context of the call needing it.
+func (a *AppAuth) SecretContext(ctx context.Context) (string, error) {
+	return a.Token(ctx)
+}
+
+//Token returns a token of the configured installation. It is a
+//restclient.TokenSource.
+func (a *AppAuth) Token(ctx context.Context) (string, error) {
+	return a.InstallationToken(ctx, a.settings.InstallationID)
+}
+
+//InstallationToken returns a token of installationID, requesting a new one
+//when the cached token expires within RefreshBefore.
+func (a *AppAuth) InstallationToken(ctx context.Context, installationID int64) (string, error) {
+	a.mutex.Lock()
+	token, ok := a.tokens[installationID]
+	if !ok {
+		token = &installationToken{}
+		a.tokens[installationID] = token
+	}
+	a.mutex.Unlock()
+
+	//concurrent callers wait for a single refresh of the same installation
+	token.mutex.Lock()
+	defer token.mutex.Unlock()
+	if token.value != "" && now().Add(a.settings.RefreshBefore).Before(token.expiresAt) {
+		return token.value, nil
+	}
+	value, expiresAt, err := a.requestToken(ctx, installationID)
+	if err != nil {
+		return "", err
+	}
+	token.value, token.expiresAt = value, expiresAt
+	log.InfoContext(ctx, "github installation token refreshed", log.Int64("installation", installationID), log.String("expires_at", expiresAt.UTC().Format(time.RFC3339)))
+	return value, nil
+}
+
+func (a *AppAuth) requestToken(ctx context.Context, installationID int64) (string, time.Time, error) {
+	jwt, err := a.jwt()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	url := config.Get().Github.BaseURL + fmt.Sprintf(pathInstallationToken, installationID)
+	headers := http.Header{"Authorization": {"Bearer " + jwt}, "Accept": {"application/vnd.github+json"}}
+	//the jwt changes on every request, the quota is the one of the app
+	response, err := restclient.Post(ctx, url, nil, headers, restclient.WithRateLimitKey(fmt.Sprintf("github app %d", a.settings.AppID)))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("error requesting a github installation token: %w", err)
+	}
+	if response.StatusCode != http.StatusCreated {
+		response.Body.Close()
+		return "", time.Time{}, fmt.Errorf("error requesting a github installation token: status %d", response.StatusCode)
+	}
+	var result struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := restclient.DecodeJSON(response, &result); err != nil {
+		return "", time.Time{}, fmt.Errorf("error reading the github installation token: %w", err)
+	}
+	if result.Token == "" {
+		return "", time.Time{}, errors.New("github returned an empty installation token")
+	}
+	return result.Token, result.ExpiresAt, nil
+}
+
+//jwt signs the RS256 token identifying the app to github.
+func (a *AppAuth) jwt() (string, error) {
+	issuedAt := now().Add(-jwtSkew)
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]int64{
+		"iat": issuedAt.Unix(),
+		"exp": issuedAt.Add(jwtLifetime).Unix(),
+		"iss": a.settings.AppID,
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("error signing the github app jwt: %s", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,152 @@
+package github_provider
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/clients/restclient"
+	"github.com/jebo87/golang-microservices/src/api/secrets"
+	"github.com/jebo87/golang-microservices/src/api/utils/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+const installationTokenURL = "https://api.github.com/app/installations/42/access_tokens"
+
+func newAppAuth(t *testing.T) (*AppAuth, *rsa.PublicKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	file := filepath.Join(t.TempDir(), "app.pem")
+	encoded := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	assert.Nil(t, ioutil.WriteFile(file, encoded, 0600))
+
+	auth, err := NewAppAuth(AppSettings{AppID: 7, InstallationID: 42, PrivateKeyFile: file, RefreshBefore: 5 * time.Minute})
+	assert.Nil(t, err)
+	return auth, &key.PublicKey
+}
+
+func useTransport(t *testing.T) (*mocks.Transport, context.Context) {
+	restclient.StopMockups()
+	t.Cleanup(restclient.StartMockups)
+	transport := mocks.NewTransport()
+	return transport, restclient.ContextWithClient(context.Background(), transport)
+}
+
+func useNow(t *testing.T, at time.Time) {
+	previous := now
+	t.Cleanup(func() { now = previous })
+	now = func() time.Time { return at }
+}
+
+func tokenResponse(token string, expiresAt time.Time) map[string]interface{} {
+	return map[string]interface{}{"token": token, "expires_at": expiresAt.UTC().Format(time.RFC3339)}
+}
+
+func TestAppAuthSignsJWT(t *testing.T) {
+	start := time.Now()
+	useNow(t, start)
+	auth, public := newAppAuth(t)
+	transport, ctx := useTransport(t)
+	transport.On(mocks.Match(http.MethodPost, installationTokenURL)).
+		RespondJSON(http.StatusCreated, tokenResponse("ghs_first", start.Add(time.Hour)))
+
+	token, err := auth.Token(ctx)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "ghs_first", token)
+
+	calls := transport.Calls()
+	assert.EqualValues(t, 1, len(calls))
+	jwt := strings.TrimPrefix(calls[0].Header.Get("Authorization"), "Bearer ")
+	parts := strings.Split(jwt, ".")
+	assert.EqualValues(t, 3, len(parts))
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	assert.Nil(t, rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature))
+
+	var claims map[string]int64
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	assert.Nil(t, json.Unmarshal(payload, &claims))
+	assert.EqualValues(t, 7, claims["iss"])
+	assert.EqualValues(t, start.Add(-time.Minute).Unix(), claims["iat"])
+	assert.EqualValues(t, start.Add(8*time.Minute).Unix(), claims["exp"])
+}
+
+func TestAppAuthCachesTokensUntilTheyExpire(t *testing.T) {
+	start := time.Now()
+	useNow(t, start)
+	auth, _ := newAppAuth(t)
+	transport, ctx := useTransport(t)
+	transport.On(mocks.Match(http.MethodPost, installationTokenURL)).
+		RespondJSON(http.StatusCreated, tokenResponse("ghs_first", start.Add(time.Hour))).
+		RespondJSON(http.StatusCreated, tokenResponse("ghs_second", start.Add(2*time.Hour)))
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/app/installations/43/access_tokens")).
+		RespondJSON(http.StatusCreated, tokenResponse("ghs_other", start.Add(time.Hour)))
+
+	for i := 0; i < 3; i++ {
+		token, err := auth.Token(ctx)
+		assert.Nil(t, err)
+		assert.EqualValues(t, "ghs_first", token)
+	}
+	token, err := auth.InstallationToken(ctx, 43)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "ghs_other", token)
+
+	//the token is replaced 5 minutes before it expires
+	useNow(t, start.Add(56*time.Minute))
+	token, err = auth.Token(ctx)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "ghs_second", token)
+	transport.AssertCalled(t, mocks.Match(http.MethodPost, installationTokenURL), 2)
+}
+
+func TestAppAuthSecretContext(t *testing.T) {
+	auth, _ := newAppAuth(t)
+	transport, ctx := useTransport(t)
+	transport.On(mocks.Match(http.MethodPost, installationTokenURL)).
+		RespondJSON(http.StatusCreated, tokenResponse("ghs_first", time.Now().Add(time.Hour)))
+
+	//the client of the context is only found when the context is passed
+	token, err := secrets.SecretContext(ctx, auth)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "ghs_first", token)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = auth.InstallationToken(cancelled, 43)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestAppAuthErrors(t *testing.T) {
+	auth, _ := newAppAuth(t)
+	transport, ctx := useTransport(t)
+	transport.On(mocks.Match(http.MethodPost, installationTokenURL)).
+		RespondJSON(http.StatusUnauthorized, map[string]string{"message": "A JSON web token could not be decoded"})
+
+	_, err := auth.Token(ctx)
+	assert.EqualValues(t, "error requesting a github installation token: status 401", err.Error())
+
+	//like every POST the token request isn't retried
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/app/installations/43/access_tokens")).
+		RespondJSON(http.StatusBadGateway, map[string]string{"message": "Server Error"})
+	_, err = auth.InstallationToken(ctx, 43)
+	assert.EqualValues(t, "error requesting a github installation token: status 502", err.Error())
+	transport.AssertCalled(t, mocks.Match(http.MethodPost, "https://api.github.com/app/installations/43/access_tokens"), 1)
+
+	invalid := filepath.Join(t.TempDir(), "invalid.pem")
+	assert.Nil(t, ioutil.WriteFile(invalid, []byte("not a key"), 0600))
+	_, err = NewAppAuth(AppSettings{PrivateKeyFile: invalid})
+	assert.EqualValues(t, "github app private key is not pem encoded", err.Error())
+}
@@ -1,69 +1,127 @@
 package github_provider
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/jebo87/golang-microservices/src/api/clients/restclient"
+	"github.com/jebo87/golang-microservices/src/api/config"
 	"github.com/jebo87/golang-microservices/src/api/domain/github"
+	"github.com/jebo87/golang-microservices/src/api/log"
+	"github.com/jebo87/golang-microservices/src/api/metrics"
 )
 
 const (
-	headerAuthorization       = "Authorization"
-	headerAuthorizationFormat = "token %s"
-	urlCreateRepo             = "https://api.github.com/user/repos"
+	authorizationScheme      = "token"
+	headerRateLimitRemaining = "X-RateLimit-Remaining"
+	headerRateLimitReset     = "X-RateLimit-Reset"
+	pathCreateRepo           = "/user/repos"
+	pathCreateOrgRepo        = "/orgs/%s/repos"
 )
 
-func getAuthorizationHeader(accesToken string) string {
-	return fmt.Sprintf(headerAuthorizationFormat, accesToken)
+//client sends the token given to every call as the Authorization header.
+var client = restclient.New(restclient.Auth(authorizationScheme, restclient.TokenFromContext))
+
+type callerTokenKey struct{}
+
+//ContextWithCallerToken tells the calls made with the returned context use the
+//token of a caller, whose quota isn't recorded in the metrics.
+func ContextWithCallerToken(ctx context.Context) context.Context {
+	return context.WithValue(ctx, callerTokenKey{}, true)
+}
+
+func isCallerToken(ctx context.Context) bool {
+	caller, _ := ctx.Value(callerTokenKey{}).(bool)
+	return caller
+}
+
+func rateLimitExceeded(retryAt time.Time) *github.GithubErrorResponse {
+	return &github.GithubErrorResponse{
+		StatusCode: http.StatusTooManyRequests,
+		Message:    fmt.Sprintf("github rate limit exceeded, retry after %s", retryAt.UTC().Format(time.RFC3339)),
+	}
+}
+
+//invalidBody tells a body that isn't valid json, described by message, from
+//one that couldn't be read.
+func invalidBody(err error, message string) *github.GithubErrorResponse {
+	if !errors.Is(err, restclient.ErrInvalidJSON) {
+		message = "invalid response body"
+	}
+	return &github.GithubErrorResponse{
+		StatusCode: http.StatusInternalServerError,
+		Message:    message,
+	}
+}
+
+//CreateRepo creates the repository for the user of accessToken.
+func CreateRepo(ctx context.Context, accessToken string, request github.CreateRepoRequest) (*github.CreateRepoResponse, *github.GithubErrorResponse) {
+	return createRepo(ctx, accessToken, config.Get().Github.BaseURL+pathCreateRepo, request)
 }
 
-func CreateRepo(accessToken string, request github.CreateRepoRequest) (*github.CreateRepoResponse, *github.GithubErrorResponse) {
-	headers := http.Header{}
-	headers.Set(headerAuthorization, getAuthorizationHeader(accessToken))
+//CreateOrgRepo creates the repository in org, it is how a github App, whose
+//installation tokens have no user, creates repositories.
+func CreateOrgRepo(ctx context.Context, accessToken string, org string, request github.CreateRepoRequest) (*github.CreateRepoResponse, *github.GithubErrorResponse) {
+	return createRepo(ctx, accessToken, config.Get().Github.BaseURL+fmt.Sprintf(pathCreateOrgRepo, url.PathEscape(org)), request)
+}
+
+func createRepo(ctx context.Context, accessToken string, url string, request github.CreateRepoRequest) (*github.CreateRepoResponse, *github.GithubErrorResponse) {
+	ctx = restclient.ContextWithToken(ctx, accessToken)
 
-	response, err := restclient.Post(urlCreateRepo, request, headers)
+	//the create is not retried: when a created repository's response is lost,
+	//the retry would be refused because the name is taken and a success
+	//would be reported as a failure
+	response, err := client.Post(ctx, url, request, nil)
+	if errors.Is(err, restclient.ErrCircuitOpen) {
+		return nil, &github.GithubErrorResponse{
+			StatusCode: http.StatusServiceUnavailable,
+			Message:    "github is unavailable, try again later",
+		}
+	}
+	var rateLimitErr *restclient.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return nil, rateLimitExceeded(rateLimitErr.RetryAt)
+	}
 	if err != nil {
-		log.Println(fmt.Sprintf("error trying to create new github repo: %s", err))
+		log.ErrorContext(ctx, "error trying to create new github repo", err)
 		return nil, &github.GithubErrorResponse{
 			StatusCode: http.StatusInternalServerError,
 			Message:    err.Error(),
 		}
 	}
 
-	bytes, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		log.Println(fmt.Sprintf("error trying to create new github repo: %s", err))
-		return nil, &github.GithubErrorResponse{
-			StatusCode: http.StatusInternalServerError,
-			Message:    "invalid response body",
+	if remaining, err := strconv.Atoi(response.Header.Get(headerRateLimitRemaining)); err == nil {
+		if !isCallerToken(ctx) {
+			metrics.SetGithubRateLimitRemaining(remaining)
+		}
+		if remaining == 0 && response.StatusCode == http.StatusForbidden {
+			response.Body.Close()
+			reset, _ := strconv.ParseInt(response.Header.Get(headerRateLimitReset), 10, 64)
+			return nil, rateLimitExceeded(time.Unix(reset, 0))
 		}
 	}
-	defer response.Body.Close()
 
 	if response.StatusCode > 299 {
 		var errResponse github.GithubErrorResponse
-		if err := json.Unmarshal(bytes, &errResponse); err != nil {
-			return nil, &github.GithubErrorResponse{
-				StatusCode: http.StatusInternalServerError,
-				Message:    "invalid json response body",
-			}
+		if err := restclient.DecodeJSON(response, &errResponse); err != nil {
+			log.ErrorContext(ctx, "error trying to unmarshal github error response", err, log.Int("status", response.StatusCode))
+			return nil, invalidBody(err, "invalid json response body")
 		}
 		errResponse.StatusCode = response.StatusCode
+		log.WarnContext(ctx, "github rejected the repository creation", log.Int("status", response.StatusCode), log.String("message", errResponse.Message))
 		return nil, &errResponse
 	}
 
 	var result github.CreateRepoResponse
-	if err := json.Unmarshal(bytes, &result); err != nil {
-		log.Println(fmt.Sprintf("Error when trying to unmarshal body succesful response %s", err))
-		return nil, &github.GithubErrorResponse{
-			StatusCode: http.StatusInternalServerError,
-			Message:    "Error when trying to unmarshal body succesful response",
-		}
+	if err := restclient.DecodeJSON(response, &result); err != nil {
+		log.ErrorContext(ctx, "error when trying to unmarshal body succesful response", err)
+		return nil, invalidBody(err, "Error when trying to unmarshal body succesful response")
 	}
-	log.Println("returning result no error")
+	log.DebugContext(ctx, "github repository created", log.Int64("id", result.ID), log.String("name", result.Name))
 	return &result, nil
 }
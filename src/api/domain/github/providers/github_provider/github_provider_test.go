@@ -1,23 +1,25 @@
 package github_provider
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jebo87/golang-microservices/src/api/clients/restclient"
 	"github.com/jebo87/golang-microservices/src/api/domain/github"
+	"github.com/jebo87/golang-microservices/src/api/metrics"
+	"github.com/jebo87/golang-microservices/src/api/utils/cassette"
+	"github.com/jebo87/golang-microservices/src/api/utils/mocks"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestGetAuthorizationHeader(t *testing.T) {
-	header := getAuthorizationHeader("abc123")
-	assert.EqualValues(t, "token abc123", header)
-}
-
 func TestMain(m *testing.M) {
 	//This is executed prior to any other test.
 	restclient.StartMockups()
@@ -25,9 +27,9 @@ func TestMain(m *testing.M) {
 }
 
 func TestConstants(t *testing.T) {
-	assert.EqualValues(t, "Authorization", headerAuthorization)
-	assert.EqualValues(t, "token %s", headerAuthorizationFormat)
-	assert.EqualValues(t, "https://api.github.com/user/repos", urlCreateRepo)
+	assert.EqualValues(t, "token", authorizationScheme)
+	assert.EqualValues(t, "/user/repos", pathCreateRepo)
+	assert.EqualValues(t, "/orgs/%s/repos", pathCreateOrgRepo)
 }
 
 func TestCreateRepoErrorRestClient(t *testing.T) {
@@ -38,7 +40,7 @@ func TestCreateRepoErrorRestClient(t *testing.T) {
 		Err:        errors.New("Invalid restclient response"),
 	})
 
-	response, err := CreateRepo("", github.CreateRepoRequest{})
+	response, err := CreateRepo(context.Background(), "", github.CreateRepoRequest{})
 	assert.Nil(t, response)
 	assert.NotNil(t, err)
 	assert.EqualValues(t, "Invalid restclient response", err.Message)
@@ -58,7 +60,7 @@ func TestCreateRepoInvalidResponseBody(t *testing.T) {
 		},
 	})
 
-	response, err := CreateRepo("", github.CreateRepoRequest{})
+	response, err := CreateRepo(context.Background(), "", github.CreateRepoRequest{})
 	assert.Nil(t, response)
 	assert.NotNil(t, err)
 	assert.EqualValues(t, "invalid response body", err.Message)
@@ -77,7 +79,7 @@ func TestCreateRepoInvalidJSONResponse(t *testing.T) {
 		},
 	})
 
-	response, err := CreateRepo("", github.CreateRepoRequest{})
+	response, err := CreateRepo(context.Background(), "", github.CreateRepoRequest{})
 	assert.Nil(t, response)
 	assert.NotNil(t, err)
 	assert.EqualValues(t, "invalid json response body", err.Message)
@@ -96,7 +98,7 @@ func TestCreateRepoServerError(t *testing.T) {
 		},
 	})
 
-	response, err := CreateRepo("", github.CreateRepoRequest{})
+	response, err := CreateRepo(context.Background(), "", github.CreateRepoRequest{})
 	assert.Nil(t, response)
 	assert.NotNil(t, err)
 	assert.EqualValues(t, http.StatusInternalServerError, err.StatusCode)
@@ -115,7 +117,7 @@ func TestCreateRepoCreatedButJSONParseError(t *testing.T) {
 		},
 	})
 
-	response, err := CreateRepo("", github.CreateRepoRequest{})
+	response, err := CreateRepo(context.Background(), "", github.CreateRepoRequest{})
 	assert.Nil(t, response)
 	assert.NotNil(t, err)
 	assert.EqualValues(t, "Error when trying to unmarshal body succesful response", err.Message)
@@ -152,10 +154,159 @@ func TestCreateRepoCreatedSuccessful(t *testing.T) {
 		},
 	})
 
-	response, err := CreateRepo("", github.CreateRepoRequest{})
+	response, err := CreateRepo(context.Background(), "", github.CreateRepoRequest{})
 	assert.NotNil(t, response)
 	assert.Nil(t, err)
 	assert.EqualValues(t, "Hello-World", response.Name)
 	assert.EqualValues(t, "octocat/Hello-World", response.FullName)
 
 }
+
+func TestCreateRepoCircuitOpen(t *testing.T) {
+	restclient.FlushMockups()
+	restclient.AddMockup(restclient.Mock{
+		Url:        "https://api.github.com/user/repos",
+		HttpMethod: http.MethodPost,
+		Err:        fmt.Errorf("%w for api.github.com", restclient.ErrCircuitOpen),
+	})
+
+	response, err := CreateRepo(context.Background(), "", github.CreateRepoRequest{})
+	assert.Nil(t, response)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusServiceUnavailable, err.StatusCode)
+	assert.EqualValues(t, "github is unavailable, try again later", err.Message)
+}
+
+func TestCreateRepoSendsTokenAndBody(t *testing.T) {
+	restclient.StopMockups()
+	defer restclient.StartMockups()
+	transport := mocks.NewTransport()
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/user/repos")).
+		RespondJSON(http.StatusCreated, map[string]interface{}{"id": 123, "name": "golang-test"})
+	ctx := restclient.ContextWithClient(context.Background(), transport)
+
+	response, err := CreateRepo(ctx, "abc123", github.CreateRepoRequest{Name: "golang-test", Private: true})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 123, response.ID)
+	transport.AssertCalled(t, mocks.Match(http.MethodPost, "https://api.github.com/user/repos").
+		Header("Authorization", "token abc123").
+		JSONBody(github.CreateRepoRequest{Name: "golang-test", Private: true}), 1)
+}
+
+func TestCreateOrgRepo(t *testing.T) {
+	transport, ctx := useTransport(t)
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/orgs/jebo-org/repos")).
+		RespondJSON(http.StatusCreated, map[string]interface{}{"id": 123, "name": "golang-test", "owner": map[string]string{"login": "jebo-org"}})
+
+	response, err := CreateOrgRepo(ctx, "ghs_installation", "jebo-org", github.CreateRepoRequest{Name: "golang-test"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, "jebo-org", response.Owner.Login)
+	transport.AssertCalled(t, mocks.Match(http.MethodPost, "https://api.github.com/orgs/jebo-org/repos").
+		Header("Authorization", "token ghs_installation"), 1)
+}
+
+func TestCreateRepoIsNotRetried(t *testing.T) {
+	restclient.StopMockups()
+	defer restclient.StartMockups()
+	transport := mocks.NewTransport()
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/user/repos")).
+		RespondJSON(http.StatusBadGateway, map[string]string{"message": "Server Error"}).
+		RespondJSON(http.StatusUnprocessableEntity, map[string]string{"message": "Repository creation failed."})
+	ctx := restclient.ContextWithClient(context.Background(), transport)
+
+	_, err := CreateRepo(ctx, "abc123", github.CreateRepoRequest{Name: "golang-test"})
+	assert.EqualValues(t, http.StatusBadGateway, err.StatusCode)
+	transport.AssertCalled(t, mocks.Match(http.MethodPost, "https://api.github.com/user/repos"), 1)
+}
+
+func TestCreateRepoCassette(t *testing.T) {
+	restclient.StopMockups()
+	defer restclient.StartMockups()
+	recorder := cassette.New(t, "testdata/cassettes/create_repo.yaml", nil)
+	ctx := restclient.ContextWithClient(context.Background(), recorder)
+	token := "replayed-token"
+	if recorder.Mode() == cassette.ModeRecord {
+		token = os.Getenv("SECRET_GITHUB_ACCESS_TOKEN")
+	}
+	request := github.CreateRepoRequest{Name: "golang-cassette", Description: "recorded by github_provider_test", Private: true}
+
+	response, err := CreateRepo(ctx, token, request)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "golang-cassette", response.Name)
+	assert.EqualValues(t, "jebo87/golang-cassette", response.FullName)
+	assert.EqualValues(t, "jebo87", response.Owner.Login)
+	assert.True(t, response.Permissions.IsAdmin)
+
+	response, err = CreateRepo(ctx, token, request)
+	assert.Nil(t, response)
+	assert.EqualValues(t, http.StatusUnprocessableEntity, err.StatusCode)
+	assert.EqualValues(t, "Repository creation failed.", err.Message)
+	assert.EqualValues(t, "name already exists on this account", err.Errors[0].Message)
+}
+
+func TestCreateRepoRateLimited(t *testing.T) {
+	retryAt := time.Date(2021, 10, 18, 12, 0, 0, 0, time.UTC)
+	restclient.FlushMockups()
+	restclient.AddMockup(restclient.Mock{
+		Url:        "https://api.github.com/user/repos",
+		HttpMethod: http.MethodPost,
+		Err:        &restclient.RateLimitError{Host: "api.github.com", RetryAt: retryAt},
+	})
+
+	response, err := CreateRepo(context.Background(), "", github.CreateRepoRequest{})
+	assert.Nil(t, response)
+	assert.EqualValues(t, http.StatusTooManyRequests, err.StatusCode)
+	assert.EqualValues(t, "github rate limit exceeded, retry after 2021-10-18T12:00:00Z", err.Message)
+}
+
+func TestCreateRepoRecordsTheQuotaOfTheServerToken(t *testing.T) {
+	transport, ctx := useTransport(t)
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/user/repos")).
+		RespondWithHeaders(http.StatusCreated, http.Header{"X-Ratelimit-Remaining": {"4000"}}, `{"id":123}`).
+		RespondWithHeaders(http.StatusCreated, http.Header{"X-Ratelimit-Remaining": {"10"}}, `{"id":124}`)
+
+	_, err := CreateRepo(ctx, "server-token", github.CreateRepoRequest{Name: "golang-test"})
+	assert.Nil(t, err)
+	_, err = CreateRepo(ContextWithCallerToken(ctx), "caller-token", github.CreateRepoRequest{Name: "golang-test"})
+	assert.Nil(t, err)
+
+	scraped := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(scraped, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, scraped.Body.String(), "api_github_rate_limit_remaining 4000")
+}
+
+func TestCreateRepoQuotaExhausted(t *testing.T) {
+	restclient.FlushMockups()
+	restclient.AddMockup(restclient.Mock{
+		Url:        "https://api.github.com/user/repos",
+		HttpMethod: http.MethodPost,
+		Response: &http.Response{
+			StatusCode: http.StatusForbidden,
+			Header:     http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"1634558400"}},
+			Body:       ioutil.NopCloser(strings.NewReader(`{"message":"API rate limit exceeded for user ID 9421743."}`)),
+		},
+	})
+
+	response, err := CreateRepo(context.Background(), "", github.CreateRepoRequest{})
+	assert.Nil(t, response)
+	assert.EqualValues(t, http.StatusTooManyRequests, err.StatusCode)
+	assert.EqualValues(t, "github rate limit exceeded, retry after 2021-10-18T12:00:00Z", err.Message)
+}
+
+func TestCreateRepoUnexpectedContentType(t *testing.T) {
+	restclient.FlushMockups()
+	restclient.AddMockup(restclient.Mock{
+		Url:        "https://api.github.com/user/repos",
+		HttpMethod: http.MethodPost,
+		Response: &http.Response{
+			StatusCode: http.StatusBadGateway,
+			Header:     http.Header{"Content-Type": {"text/html"}},
+			Body:       ioutil.NopCloser(strings.NewReader(`<html>proxy error</html>`)),
+		},
+	})
+
+	response, err := CreateRepo(context.Background(), "", github.CreateRepoRequest{})
+	assert.Nil(t, response)
+	assert.EqualValues(t, http.StatusInternalServerError, err.StatusCode)
+	assert.EqualValues(t, "invalid response body", err.Message)
+}
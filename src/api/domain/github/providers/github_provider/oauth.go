@@ -0,0 +1,74 @@
+package github_provider
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/jebo87/golang-microservices/src/api/clients/restclient"
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/jebo87/golang-microservices/src/api/domain/github"
+	"github.com/jebo87/golang-microservices/src/api/log"
+)
+
+//OAuthTokenResponse is the answer of github to an oauth code exchange. It
+//holds either AccessToken or Error.
+type OAuthTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	Scope            string `json:"scope"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+//ExchangeCode exchanges the code given to the oauth callback, with the PKCE
+//verifier of the login, for the token of the user.
+func ExchangeCode(ctx context.Context, code string, verifier string) (string, *github.GithubErrorResponse) {
+	cfg := config.Get().Github.OAuth
+	form := url.Values{
+		"client_id":     {cfg.ClientID},
+		"client_secret": {cfg.ClientSecret},
+		"code":          {code},
+		"redirect_uri":  {cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	body := restclient.Bytes("application/x-www-form-urlencoded", []byte(form.Encode()))
+	headers := http.Header{"Accept": {"application/json"}}
+
+	//like every POST the exchange isn't retried, a code can only be used once
+	response, err := restclient.Post(ctx, cfg.TokenURL, body, headers)
+	if err != nil {
+		log.ErrorContext(ctx, "error exchanging the github oauth code", err)
+		return "", &github.GithubErrorResponse{
+			StatusCode: http.StatusBadGateway,
+			Message:    "error exchanging the github oauth code",
+		}
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		log.WarnContext(ctx, "github refused the oauth code exchange", log.Int("status", response.StatusCode))
+		return "", &github.GithubErrorResponse{
+			StatusCode: http.StatusBadGateway,
+			Message:    "github refused the oauth code exchange",
+		}
+	}
+
+	var result OAuthTokenResponse
+	if err := restclient.DecodeJSON(response, &result); err != nil {
+		log.ErrorContext(ctx, "error trying to unmarshal the github oauth token", err)
+		return "", invalidBody(err, "invalid json response body")
+	}
+	//github answers the errors of the exchange with a 200
+	if result.Error != "" || result.AccessToken == "" {
+		log.WarnContext(ctx, "github rejected the oauth code", log.String("error", result.Error))
+		message := "invalid github oauth code"
+		if result.ErrorDescription != "" {
+			message += ": " + result.ErrorDescription
+		}
+		return "", &github.GithubErrorResponse{
+			StatusCode: http.StatusBadRequest,
+			Message:    message,
+		}
+	}
+	return result.AccessToken, nil
+}
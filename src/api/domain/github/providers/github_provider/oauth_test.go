@@ -0,0 +1,56 @@
+package github_provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/jebo87/golang-microservices/src/api/clients/restclient"
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/jebo87/golang-microservices/src/api/utils/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+//authorizedCode approves a login on server for the PKCE verifier.
+func authorizedCode(t *testing.T, server *mocks.OAuthServer, verifier string) string {
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"client_id":             {server.ClientID},
+		"redirect_uri":          {config.Get().Github.OAuth.RedirectURL},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	browser := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	response, err := browser.Get(server.AuthorizeURL() + "?" + query.Encode())
+	assert.Nil(t, err)
+	response.Body.Close()
+	location, _ := url.Parse(response.Header.Get("Location"))
+	return location.Query().Get("code")
+}
+
+func TestExchangeCode(t *testing.T) {
+	restclient.StopMockups()
+	defer restclient.StartMockups()
+	server := mocks.NewOAuthServer("client-id", "client-secret")
+	defer server.Close()
+	previous := config.Get()
+	defer config.Set(previous)
+	cfg := config.Default()
+	cfg.Github.OAuth.ClientID = server.ClientID
+	cfg.Github.OAuth.ClientSecret = server.ClientSecret
+	cfg.Github.OAuth.RedirectURL = "https://api.example.com/auth/github/callback"
+	cfg.Github.OAuth.TokenURL = server.TokenURL()
+	config.Set(cfg)
+
+	token, err := ExchangeCode(context.Background(), authorizedCode(t, server, "right-verifier"), "right-verifier")
+	assert.Nil(t, err)
+	assert.EqualValues(t, "gho_fake_1", token)
+
+	token, err = ExchangeCode(context.Background(), authorizedCode(t, server, "right-verifier"), "wrong-verifier")
+	assert.EqualValues(t, "", token)
+	assert.EqualValues(t, http.StatusBadRequest, err.StatusCode)
+	assert.EqualValues(t, "invalid github oauth code: The code_verifier does not match the code_challenge.", err.Message)
+}
@@ -0,0 +1,36 @@
+package log
+
+import (
+	"context"
+)
+
+type contextKey struct{}
+
+//ContextWithFields returns a copy of ctx carrying fields, which are added to
+//every entry written with the context methods of a Logger.
+func ContextWithFields(ctx context.Context, fields ...Field) context.Context {
+	existing := FieldsFromContext(ctx)
+	all := make([]Field, 0, len(existing)+len(fields))
+	all = append(all, existing...)
+	all = append(all, fields...)
+	return context.WithValue(ctx, contextKey{}, all)
+}
+
+//FieldsFromContext returns the fields stored with ContextWithFields.
+func FieldsFromContext(ctx context.Context) []Field {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(contextKey{}).([]Field)
+	return fields
+}
+
+func withContext(ctx context.Context, fields []Field) []Field {
+	stored := FieldsFromContext(ctx)
+	if len(stored) == 0 {
+		return fields
+	}
+	all := make([]Field, 0, len(stored)+len(fields))
+	all = append(all, stored...)
+	return append(all, fields...)
+}
@@ -0,0 +1,207 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/log/logruslog"
+	"github.com/jebo87/golang-microservices/src/api/log/zaplog"
+)
+
+const (
+	BackendZap    = "zap"
+	BackendLogrus = "logrus"
+)
+
+//Logger is the logging facade used by every package of the api. The actual
+//writing is done by the logrus or the zap backend, picked from config.
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, err error, fields ...Field)
+
+	//The context methods add the fields stored in ctx with ContextWithFields.
+	DebugContext(ctx context.Context, msg string, fields ...Field)
+	InfoContext(ctx context.Context, msg string, fields ...Field)
+	WarnContext(ctx context.Context, msg string, fields ...Field)
+	ErrorContext(ctx context.Context, msg string, err error, fields ...Field)
+
+	//With returns a child logger adding fields to every entry.
+	With(fields ...Field) Logger
+}
+
+//Field is a typed key/value pair attached to a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key string, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Bool(key string, value bool) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+type level int
+
+const (
+	debugLevel level = iota
+	infoLevel
+	warnLevel
+	errorLevel
+)
+
+//backend writes entries for a specific logging library.
+type backend interface {
+	write(lvl level, msg string, err error, fields []Field)
+	with(fields []Field) backend
+}
+
+var (
+	current atomic.Value
+)
+
+func init() {
+	current.Store(newLogger(newZapBackend()))
+}
+
+//SetBackend switches the logger returned by L to the given backend.
+func SetBackend(name string) error {
+	switch strings.ToLower(name) {
+	case BackendZap:
+		current.Store(newLogger(newZapBackend()))
+	case BackendLogrus:
+		current.Store(newLogger(newLogrusBackend()))
+	default:
+		return fmt.Errorf("unknown log backend %q", name)
+	}
+	return nil
+}
+
+//SetLevel changes the level of both backends.
+func SetLevel(level string) error {
+	if err := logruslog.SetLevel(level); err != nil {
+		return err
+	}
+	return zaplog.SetLevel(level)
+}
+
+//SetProduction switches both backends to json in production and to a
+//readable format otherwise. SetBackend must be called after it for the
+//logger returned by L to use the new format.
+func SetProduction(production bool) error {
+	logruslog.SetProduction(production)
+	return zaplog.SetProduction(production)
+}
+
+//Sync flushes any buffered entry, it must be called before the process exits.
+func Sync() error {
+	return zaplog.Zap.Sync()
+}
+
+//L returns the logger of the configured backend.
+func L() Logger {
+	return current.Load().(Logger)
+}
+
+func Debug(msg string, fields ...Field) {
+	L().Debug(msg, fields...)
+}
+
+func Info(msg string, fields ...Field) {
+	L().Info(msg, fields...)
+}
+
+func Warn(msg string, fields ...Field) {
+	L().Warn(msg, fields...)
+}
+
+func Error(msg string, err error, fields ...Field) {
+	L().Error(msg, err, fields...)
+}
+
+func DebugContext(ctx context.Context, msg string, fields ...Field) {
+	L().DebugContext(ctx, msg, fields...)
+}
+
+func InfoContext(ctx context.Context, msg string, fields ...Field) {
+	L().InfoContext(ctx, msg, fields...)
+}
+
+func WarnContext(ctx context.Context, msg string, fields ...Field) {
+	L().WarnContext(ctx, msg, fields...)
+}
+
+func ErrorContext(ctx context.Context, msg string, err error, fields ...Field) {
+	L().ErrorContext(ctx, msg, err, fields...)
+}
+
+func With(fields ...Field) Logger {
+	return L().With(fields...)
+}
+
+type logger struct {
+	backend backend
+}
+
+func newLogger(b backend) Logger {
+	return &logger{backend: b}
+}
+
+func (l *logger) Debug(msg string, fields ...Field) {
+	l.backend.write(debugLevel, msg, nil, fields)
+}
+
+func (l *logger) Info(msg string, fields ...Field) {
+	l.backend.write(infoLevel, msg, nil, fields)
+}
+
+func (l *logger) Warn(msg string, fields ...Field) {
+	l.backend.write(warnLevel, msg, nil, fields)
+}
+
+func (l *logger) Error(msg string, err error, fields ...Field) {
+	l.backend.write(errorLevel, msg, err, fields)
+}
+
+func (l *logger) DebugContext(ctx context.Context, msg string, fields ...Field) {
+	l.backend.write(debugLevel, msg, nil, withContext(ctx, fields))
+}
+
+func (l *logger) InfoContext(ctx context.Context, msg string, fields ...Field) {
+	l.backend.write(infoLevel, msg, nil, withContext(ctx, fields))
+}
+
+func (l *logger) WarnContext(ctx context.Context, msg string, fields ...Field) {
+	l.backend.write(warnLevel, msg, nil, withContext(ctx, fields))
+}
+
+func (l *logger) ErrorContext(ctx context.Context, msg string, err error, fields ...Field) {
+	l.backend.write(errorLevel, msg, err, withContext(ctx, fields))
+}
+
+func (l *logger) With(fields ...Field) Logger {
+	return &logger{backend: l.backend.with(fields)}
+}
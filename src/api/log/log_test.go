@@ -0,0 +1,83 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/jebo87/golang-microservices/src/api/log/logruslog"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func zapTestLogger(buffer *bytes.Buffer) Logger {
+	encoder := zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "msg", LevelKey: "level", EncodeLevel: zapcore.LowercaseLevelEncoder})
+	core := zapcore.NewCore(encoder, zapcore.AddSync(buffer), zap.DebugLevel)
+	return newLogger(&zapBackend{logger: zap.New(core)})
+}
+
+func logrusTestLogger(buffer *bytes.Buffer) Logger {
+	logger := &logrus.Logger{Out: buffer, Level: logrus.DebugLevel, Formatter: &logrus.JSONFormatter{}}
+	return newLogger(&logrusBackend{entry: logrus.NewEntry(logger)})
+}
+
+func decode(t *testing.T, buffer *bytes.Buffer) map[string]interface{} {
+	entry := make(map[string]interface{})
+	assert.Nil(t, json.Unmarshal(buffer.Bytes(), &entry))
+	return entry
+}
+
+func TestBackends(t *testing.T) {
+	for name, build := range map[string]func(*bytes.Buffer) Logger{
+		BackendZap:    zapTestLogger,
+		BackendLogrus: logrusTestLogger,
+	} {
+		t.Run(name, func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			logger := build(buffer).With(String("component", "test"))
+
+			ctx := ContextWithFields(context.Background(), String("request_id", "abc"))
+			logger.ErrorContext(ctx, "something failed", errors.New("boom"), Int("status", 502))
+
+			entry := decode(t, buffer)
+			assert.EqualValues(t, "something failed", entry["msg"])
+			assert.EqualValues(t, "error", entry["level"])
+			assert.EqualValues(t, "test", entry["component"])
+			assert.EqualValues(t, "abc", entry["request_id"])
+			assert.EqualValues(t, 502, entry["status"])
+			assert.EqualValues(t, "boom", entry["error"])
+		})
+	}
+}
+
+func TestContextWithFieldsDoesNotShareSlices(t *testing.T) {
+	parent := ContextWithFields(context.Background(), String("a", "1"))
+	first := ContextWithFields(parent, String("b", "2"))
+	second := ContextWithFields(parent, String("c", "3"))
+
+	assert.EqualValues(t, []Field{String("a", "1"), String("b", "2")}, FieldsFromContext(first))
+	assert.EqualValues(t, []Field{String("a", "1"), String("c", "3")}, FieldsFromContext(second))
+	assert.Nil(t, FieldsFromContext(context.Background()))
+}
+
+func TestSetBackend(t *testing.T) {
+	defer SetBackend(BackendZap)
+
+	assert.Nil(t, SetBackend(BackendLogrus))
+	assert.IsType(t, &logrusBackend{}, L().(*logger).backend)
+
+	assert.NotNil(t, SetBackend("log4j"))
+	assert.IsType(t, &logrusBackend{}, L().(*logger).backend)
+}
+
+func TestSetLevel(t *testing.T) {
+	defer SetLevel("info")
+
+	assert.Nil(t, SetLevel("debug"))
+	assert.EqualValues(t, logrus.DebugLevel, logruslog.Log.GetLevel())
+	assert.NotNil(t, SetLevel("loud"))
+}
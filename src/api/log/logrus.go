@@ -0,0 +1,43 @@
+package log
+
+import (
+	"github.com/jebo87/golang-microservices/src/api/log/logruslog"
+	"github.com/sirupsen/logrus"
+)
+
+type logrusBackend struct {
+	entry *logrus.Entry
+}
+
+func newLogrusBackend() backend {
+	return &logrusBackend{entry: logrus.NewEntry(logruslog.Log)}
+}
+
+func (b *logrusBackend) write(lvl level, msg string, err error, fields []Field) {
+	entry := b.entry.WithFields(toLogrusFields(fields))
+	if err != nil {
+		entry = entry.WithError(err)
+	}
+	switch lvl {
+	case debugLevel:
+		entry.Debug(msg)
+	case infoLevel:
+		entry.Info(msg)
+	case warnLevel:
+		entry.Warn(msg)
+	default:
+		entry.Error(msg)
+	}
+}
+
+func (b *logrusBackend) with(fields []Field) backend {
+	return &logrusBackend{entry: b.entry.WithFields(toLogrusFields(fields))}
+}
+
+func toLogrusFields(fields []Field) logrus.Fields {
+	result := make(logrus.Fields, len(fields))
+	for _, field := range fields {
+		result[field.Key] = field.Value
+	}
+	return result
+}
@@ -15,7 +15,7 @@ var (
 
 func init() {
 
-	level, err := logrus.ParseLevel(config.LogLevel)
+	level, err := logrus.ParseLevel(config.Get().Log.Level)
 	if err != nil {
 		level = logrus.DebugLevel
 	}
@@ -24,13 +24,28 @@ func init() {
 		Out:   os.Stdout,
 		Level: level,
 	}
+	//only the defaults and the environment are loaded yet, SetProduction is
+	//called again with the configuration loaded
+	SetProduction(config.IsProduction())
+}
 
-	if config.IsProduction() {
-		Log.Formatter = &logrus.JSONFormatter{}
+//SetProduction makes Log write json in production and text otherwise.
+func SetProduction(production bool) {
+	if production {
+		Log.SetFormatter(&logrus.JSONFormatter{})
 	} else {
-		Log.Formatter = &logrus.TextFormatter{}
+		Log.SetFormatter(&logrus.TextFormatter{})
 	}
+}
 
+//SetLevel changes the level of the logrus logger.
+func SetLevel(level string) error {
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	Log.SetLevel(parsed)
+	return nil
 }
 
 func Info(msg string, tags ...string) {
@@ -56,7 +71,12 @@ func Debug(msg string, tags ...string) {
 func parseFields(tags ...string) logrus.Fields {
 	result := make(logrus.Fields, len(tags))
 	for _, tag := range tags {
-		els := strings.Split(tag, ":")
+		//tags without a colon are kept with an empty value instead of panicking
+		els := strings.SplitN(tag, ":", 2)
+		if len(els) < 2 {
+			result[strings.TrimSpace(els[0])] = ""
+			continue
+		}
 		result[strings.TrimSpace(els[0])] = strings.TrimSpace(els[1])
 	}
 	return result
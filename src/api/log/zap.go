@@ -0,0 +1,43 @@
+package log
+
+import (
+	"github.com/jebo87/golang-microservices/src/api/log/zaplog"
+	"go.uber.org/zap"
+)
+
+type zapBackend struct {
+	logger *zap.Logger
+}
+
+func newZapBackend() backend {
+	return &zapBackend{logger: zaplog.Zap}
+}
+
+func (b *zapBackend) write(lvl level, msg string, err error, fields []Field) {
+	zapFields := toZapFields(fields)
+	if err != nil {
+		zapFields = append(zapFields, zap.Error(err))
+	}
+	switch lvl {
+	case debugLevel:
+		b.logger.Debug(msg, zapFields...)
+	case infoLevel:
+		b.logger.Info(msg, zapFields...)
+	case warnLevel:
+		b.logger.Warn(msg, zapFields...)
+	default:
+		b.logger.Error(msg, zapFields...)
+	}
+}
+
+func (b *zapBackend) with(fields []Field) backend {
+	return &zapBackend{logger: b.logger.With(toZapFields(fields)...)}
+}
+
+func toZapFields(fields []Field) []zap.Field {
+	result := make([]zap.Field, 0, len(fields))
+	for _, field := range fields {
+		result = append(result, zap.Any(field.Key, field.Value))
+	}
+	return result
+}
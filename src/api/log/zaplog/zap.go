@@ -9,14 +9,36 @@ import (
 )
 
 var (
-	Zap *zap.Logger
+	Zap      *zap.Logger
+	level    = zap.NewAtomicLevelAt(zap.InfoLevel)
+	encoding string
 )
 
 func init() {
+	//keeps the info level when the configured one is not valid
+	_ = SetLevel(config.Get().Log.Level)
+	//only the defaults and the environment are loaded yet, SetProduction is
+	//called again with the configuration loaded
+	if err := SetProduction(config.IsProduction()); err != nil {
+		panic(err)
+	}
+}
+
+//SetProduction rebuilds Zap to write json in production and to the console
+//otherwise. Loggers taken from Zap before keep their encoding.
+func SetProduction(production bool) error {
+	wanted := "console"
+	if production {
+		wanted = "json"
+	}
+	if Zap != nil && wanted == encoding {
+		return nil
+	}
+
 	logConfig := zap.Config{
 		OutputPaths: []string{"stdout"},
-		Encoding:    "json",
-		Level:       zap.NewAtomicLevelAt(zap.InfoLevel),
+		Encoding:    wanted,
+		Level:       level,
 		EncoderConfig: zapcore.EncoderConfig{
 			MessageKey:   "msg",
 			LevelKey:     "level",
@@ -26,17 +48,22 @@ func init() {
 			EncodeCaller: zapcore.ShortCallerEncoder,
 		},
 	}
-
-	if config.IsProduction() {
-		logConfig.Encoding = "json"
-	} else {
-		logConfig.Encoding = "console"
-	}
-	var err error
-	Zap, err = logConfig.Build()
+	logger, err := logConfig.Build()
 	if err != nil {
-		panic(err)
+		return err
+	}
+	Zap, encoding = logger, wanted
+	return nil
+}
+
+//SetLevel changes the level of the zap logger.
+func SetLevel(l string) error {
+	var parsed zapcore.Level
+	if err := parsed.UnmarshalText([]byte(l)); err != nil {
+		return err
 	}
+	level.SetLevel(parsed)
+	return nil
 }
 
 func Debug(msg string, tags ...zap.Field) {
@@ -0,0 +1,229 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "api"
+
+	OutcomeSuccess = "success"
+	OutcomePartial = "partial"
+	OutcomeFailure = "failure"
+
+	ThrottleDelayed  = "delayed"
+	ThrottleRejected = "rejected"
+
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+
+	PhaseDNS       = "dns"
+	PhaseConnect   = "connect"
+	PhaseTLS       = "tls"
+	PhaseFirstByte = "ttfb"
+	PhaseTotal     = "total"
+
+	FaultDelay  = "delay"
+	FaultError  = "error"
+	FaultStatus = "status"
+
+	//statusError labels upstream calls that failed without a response.
+	statusError = "error"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Requests handled by the api, by route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time spent handling requests, by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	upstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Latency of the calls made by restclient, by host, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"host", "method", "status"})
+
+	upstreamErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_errors_total",
+		Help:      "Calls made by restclient that failed without a response (status 'error') or with a 5xx status.",
+	}, []string{"host", "method", "status"})
+
+	upstreamRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_retries_total",
+		Help:      "Calls retried by restclient, by host, method and the status (or 'error') of the failed attempt.",
+	}, []string{"host", "method", "status"})
+
+	circuitBreakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "upstream_circuit_breaker_state",
+		Help:      "1 for the current state (closed, open, half-open) of the restclient circuit breaker of every host.",
+	}, []string{"host", "state"})
+
+	upstreamThrottled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_throttled_total",
+		Help:      "Calls made by restclient delayed or rejected by the rate limiter of the host.",
+	}, []string{"host", "outcome"})
+
+	upstreamPhases = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_phase_duration_seconds",
+		Help:      "Time spent by the calls made by restclient in every phase (dns, connect, tls, ttfb, total), by host.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"host", "phase"})
+
+	upstreamConnections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_connections_total",
+		Help:      "Connections used by the calls made by restclient, by host and whether they were reused from the pool.",
+	}, []string{"host", "reused"})
+
+	injectedFaults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_injected_faults_total",
+		Help:      "Faults (delay, error, status) injected by restclient in the calls to a host.",
+	}, []string{"host", "fault"})
+
+	upstreamCache = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_cache_total",
+		Help:      "GET calls made by restclient answered from the cache (hit, on a 304) or by the host (miss).",
+	}, []string{"host", "result"})
+
+	batchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "create_repos_batch_size",
+		Help:      "Number of repositories requested in every CreateRepos batch.",
+		Buckets:   []float64{1, 2, 5, 10, 20, 50, 100},
+	})
+
+	batchOutcomes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "create_repos_batches_total",
+		Help:      "CreateRepos batches by outcome (success, partial, failure).",
+	}, []string{"outcome"})
+
+	githubRateLimitRemaining = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "github_rate_limit_remaining",
+		Help:      "Last X-RateLimit-Remaining value returned by github for the token of the server.",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		upstreamDuration,
+		upstreamErrors,
+		upstreamRetries,
+		circuitBreakerState,
+		upstreamThrottled,
+		upstreamCache,
+		upstreamPhases,
+		upstreamConnections,
+		injectedFaults,
+		batchSize,
+		batchOutcomes,
+		githubRateLimitRemaining,
+	)
+}
+
+//Handler serves the metrics in the prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+//ObserveHTTPRequest records a request handled by the api. route is the
+//route template, e.g. /repository, not the raw path.
+func ObserveHTTPRequest(method string, route string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(method, route, code).Inc()
+	httpDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+//ObserveUpstreamRequest records a call made by restclient. A nil response
+//means the call failed before getting one.
+func ObserveUpstreamRequest(host string, method string, response *http.Response, duration time.Duration) {
+	status := statusError
+	if response != nil {
+		status = strconv.Itoa(response.StatusCode)
+	}
+	upstreamDuration.WithLabelValues(host, method, status).Observe(duration.Seconds())
+	if response == nil || response.StatusCode >= http.StatusInternalServerError {
+		upstreamErrors.WithLabelValues(host, method, status).Inc()
+	}
+}
+
+//ObserveUpstreamRetry records a call made by restclient that is sent again
+//because of the given failed attempt.
+func ObserveUpstreamRetry(host string, method string, response *http.Response) {
+	status := statusError
+	if response != nil {
+		status = strconv.Itoa(response.StatusCode)
+	}
+	upstreamRetries.WithLabelValues(host, method, status).Inc()
+}
+
+//SetCircuitBreakerState records the transition of the circuit breaker of host.
+func SetCircuitBreakerState(host string, previous string, current string) {
+	circuitBreakerState.WithLabelValues(host, previous).Set(0)
+	circuitBreakerState.WithLabelValues(host, current).Set(1)
+}
+
+//ObserveUpstreamThrottled records a call delayed or rejected by the rate limiter.
+func ObserveUpstreamThrottled(host string, outcome string) {
+	upstreamThrottled.WithLabelValues(host, outcome).Inc()
+}
+
+//ObserveUpstreamPhase records the time a call made by restclient spent in phase.
+func ObserveUpstreamPhase(host string, phase string, duration time.Duration) {
+	upstreamPhases.WithLabelValues(host, phase).Observe(duration.Seconds())
+}
+
+//ObserveUpstreamConnection records the connection used by a call made by restclient.
+func ObserveUpstreamConnection(host string, reused bool) {
+	upstreamConnections.WithLabelValues(host, strconv.FormatBool(reused)).Inc()
+}
+
+//ObserveInjectedFault records a fault injected in a call made by restclient.
+func ObserveInjectedFault(host string, fault string) {
+	injectedFaults.WithLabelValues(host, fault).Inc()
+}
+
+//ObserveUpstreamCache records a cacheable call answered from the cache or by the host.
+func ObserveUpstreamCache(host string, result string) {
+	upstreamCache.WithLabelValues(host, result).Inc()
+}
+
+//ObserveBatch records the size and the outcome of a CreateRepos batch.
+func ObserveBatch(size int, outcome string) {
+	batchSize.Observe(float64(size))
+	batchOutcomes.WithLabelValues(outcome).Inc()
+}
+
+//SetGithubRateLimitRemaining records the remaining github rate limit of the
+//token of the server, the quotas of the callers' tokens are not recorded.
+func SetGithubRateLimitRemaining(remaining int) {
+	githubRateLimitRemaining.Set(float64(remaining))
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func scrape(t *testing.T) string {
+	response := httptest.NewRecorder()
+	Handler().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.EqualValues(t, http.StatusOK, response.Code)
+	body, err := ioutil.ReadAll(response.Body)
+	assert.Nil(t, err)
+	return string(body)
+}
+
+func TestObserveHTTPRequest(t *testing.T) {
+	ObserveHTTPRequest(http.MethodPost, "/repository", http.StatusCreated, 20*time.Millisecond)
+
+	assert.EqualValues(t, 1, testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodPost, "/repository", "201")))
+	assert.Contains(t, scrape(t), `api_http_request_duration_seconds_count{method="POST",route="/repository",status="201"} 1`)
+}
+
+func TestObserveUpstreamRequest(t *testing.T) {
+	ObserveUpstreamRequest("api.github.com", http.MethodPost, &http.Response{StatusCode: http.StatusCreated}, time.Millisecond)
+	ObserveUpstreamRequest("api.github.com", http.MethodPost, &http.Response{StatusCode: http.StatusBadGateway}, time.Millisecond)
+	ObserveUpstreamRequest("api.github.com", http.MethodPost, nil, time.Millisecond)
+
+	assert.EqualValues(t, 0, testutil.ToFloat64(upstreamErrors.WithLabelValues("api.github.com", http.MethodPost, "201")))
+	assert.EqualValues(t, 1, testutil.ToFloat64(upstreamErrors.WithLabelValues("api.github.com", http.MethodPost, "502")))
+	assert.EqualValues(t, 1, testutil.ToFloat64(upstreamErrors.WithLabelValues("api.github.com", http.MethodPost, "error")))
+	assert.Contains(t, scrape(t), `api_upstream_request_duration_seconds_count{host="api.github.com",method="POST",status="201"} 1`)
+}
+
+func TestObserveBatch(t *testing.T) {
+	ObserveBatch(3, OutcomePartial)
+
+	assert.EqualValues(t, 1, testutil.ToFloat64(batchOutcomes.WithLabelValues(OutcomePartial)))
+	assert.Contains(t, scrape(t), `api_create_repos_batch_size_count 1`)
+}
+
+func TestSetGithubRateLimitRemaining(t *testing.T) {
+	SetGithubRateLimitRemaining(4999)
+
+	assert.EqualValues(t, 4999, testutil.ToFloat64(githubRateLimitRemaining))
+	assert.Contains(t, scrape(t), "api_github_rate_limit_remaining 4999")
+}
+
+func TestObserveUpstreamRetry(t *testing.T) {
+	ObserveUpstreamRetry("api.github.com", http.MethodGet, &http.Response{StatusCode: http.StatusServiceUnavailable})
+	ObserveUpstreamRetry("api.github.com", http.MethodGet, nil)
+
+	assert.EqualValues(t, 1, testutil.ToFloat64(upstreamRetries.WithLabelValues("api.github.com", http.MethodGet, "503")))
+	assert.EqualValues(t, 1, testutil.ToFloat64(upstreamRetries.WithLabelValues("api.github.com", http.MethodGet, "error")))
+}
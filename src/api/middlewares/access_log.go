@@ -0,0 +1,183 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/jebo87/golang-microservices/src/api/log"
+)
+
+const (
+	redacted = "[REDACTED]"
+)
+
+var (
+	//writeAccessLog is swapped by tests to capture the events.
+	writeAccessLog = log.InfoContext
+	//sample returns a number in [0, 1) compared against the route sample rate.
+	sample = rand.Float64
+
+	//credentialHeaders carry the github tokens or the sessions of the
+	//callers, they are redacted whatever access_log.redact_headers says.
+	credentialHeaders = []string{"Authorization", "X-GitHub-Token", "Cookie"}
+)
+
+//AccessLog writes one structured log event per request, once the response
+//has been written. Successful requests are sampled by route template using
+//access_log.sample_rates, requests ending with a status >= 400 are always logged.
+//The request_id and trace_id fields come from the request context.
+func AccessLog(c *gin.Context) {
+	cfg := config.Get().AccessLog
+	if !cfg.Enabled {
+		c.Next()
+		return
+	}
+
+	start := time.Now()
+	body := &countingReader{ReadCloser: c.Request.Body}
+	var captured []byte
+	if c.Request.Body != nil && c.Request.Body != http.NoBody {
+		if cfg.LogBody && isJSON(c.Request.Header.Get("Content-Type")) {
+			captured = peekBody(c.Request, cfg.MaxBodyBytes)
+			body.ReadCloser = c.Request.Body
+		}
+		c.Request.Body = body
+	}
+	//headers are copied before the handlers can modify them
+	headers := redactHeaders(c.Request.Header, cfg.RedactHeaders)
+
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = unmatchedRoute
+	}
+	status := c.Writer.Status()
+	if status < http.StatusBadRequest && !sampled(cfg.SampleRates, route) {
+		return
+	}
+
+	bytesIn := c.Request.ContentLength
+	if bytesIn < 0 {
+		//chunked bodies, only what the handlers read is known
+		bytesIn = body.count
+	}
+	bytesOut := c.Writer.Size()
+	if bytesOut < 0 {
+		bytesOut = 0
+	}
+	fields := []log.Field{
+		log.String("method", c.Request.Method),
+		log.String("route", route),
+		log.Int("status", status),
+		log.Duration("latency", time.Since(start)),
+		log.Int64("bytes_in", bytesIn),
+		log.Int("bytes_out", bytesOut),
+		log.String("client_ip", c.ClientIP()),
+		log.Any("headers", headers),
+	}
+	if identity := GetClientIdentity(c); identity != "" {
+		fields = append(fields, log.String("client_identity", identity))
+	}
+	if captured != nil {
+		fields = append(fields, log.String("body", redactBody(captured, cfg.RedactFields)))
+	}
+	writeAccessLog(c.Request.Context(), "request", fields...)
+}
+
+func sampled(rates map[string]float64, route string) bool {
+	rate, ok := rates[route]
+	if !ok || rate >= 1 {
+		return true
+	}
+	return sample() < rate
+}
+
+func isJSON(contentType string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(contentType)), "application/json")
+}
+
+//peekBody reads up to limit bytes of the body and puts them back so the
+//handlers still see the whole body. It returns nil when the body is larger than limit.
+func peekBody(request *http.Request, limit int) []byte {
+	buffer, err := ioutil.ReadAll(io.LimitReader(request.Body, int64(limit)+1))
+	request.Body = readCloser{io.MultiReader(bytes.NewReader(buffer), request.Body), request.Body}
+	if err != nil || len(buffer) > limit {
+		return nil
+	}
+	return buffer
+}
+
+func redactHeaders(headers http.Header, sensitive []string) map[string]string {
+	result := make(map[string]string, len(headers))
+	for name, values := range headers {
+		if isSensitive(name, sensitive) || isSensitive(name, credentialHeaders) {
+			result[name] = redacted
+		} else {
+			result[name] = strings.Join(values, ", ")
+		}
+	}
+	return result
+}
+
+//redactBody replaces the value of every sensitive field, at any depth, of a json body.
+func redactBody(body []byte, sensitive []string) string {
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return "<invalid json>"
+	}
+	result, _ := json.Marshal(redactValue(document, sensitive))
+	return string(result)
+}
+
+func redactValue(value interface{}, sensitive []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if isSensitive(key, sensitive) {
+				v[key] = redacted
+			} else {
+				v[key] = redactValue(field, sensitive)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactValue(v[i], sensitive)
+		}
+	}
+	return value
+}
+
+func isSensitive(name string, sensitive []string) bool {
+	for _, s := range sensitive {
+		if strings.EqualFold(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+//countingReader counts the bytes of the body actually read by the handlers.
+type countingReader struct {
+	io.ReadCloser
+	count int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.count += int64(n)
+	return n, err
+}
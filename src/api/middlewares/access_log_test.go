@@ -0,0 +1,174 @@
+package middlewares
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/jebo87/golang-microservices/src/api/log"
+	"github.com/jebo87/golang-microservices/src/api/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+type accessLogEntry struct {
+	msg    string
+	fields map[string]interface{}
+}
+
+func captureAccessLog(t *testing.T, cfg config.AccessLogConfig) *[]accessLogEntry {
+	previous := config.Get()
+	updated := previous
+	updated.AccessLog = cfg
+	config.Set(updated)
+
+	entries := &[]accessLogEntry{}
+	writeAccessLog = func(ctx context.Context, msg string, fields ...log.Field) {
+		entry := accessLogEntry{msg: msg, fields: make(map[string]interface{})}
+		for _, f := range append(log.FieldsFromContext(ctx), fields...) {
+			entry.fields[f.Key] = f.Value
+		}
+		*entries = append(*entries, entry)
+	}
+	t.Cleanup(func() {
+		config.Set(previous)
+		writeAccessLog = log.InfoContext
+	})
+	return entries
+}
+
+func accessLogRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(RequestID, AccessLog)
+	router.POST("/users/:id", func(c *gin.Context) {
+		body, _ := ioutil.ReadAll(c.Request.Body)
+		c.String(http.StatusCreated, string(body))
+	})
+	router.GET("/marco", func(c *gin.Context) {
+		c.String(http.StatusOK, "polo")
+	})
+	return router
+}
+
+func TestAccessLogFieldsAndRedaction(t *testing.T) {
+	entries := captureAccessLog(t, config.AccessLogConfig{
+		Enabled:       true,
+		RedactHeaders: []string{"Authorization", "Cookie"},
+		RedactFields:  []string{"password"},
+		LogBody:       true,
+		MaxBodyBytes:  1024,
+	})
+
+	payload := `{"name":"x","password":"hunter2","nested":[{"Password":"p"}]}`
+	request := httptest.NewRequest(http.MethodPost, "/users/42", strings.NewReader(payload))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "token secret")
+	request.Header.Set("Cookie", "session=abc")
+	request.Header.Set("X-Request-ID", "abc-123")
+	response := httptest.NewRecorder()
+	accessLogRouter().ServeHTTP(response, request)
+
+	//the handler still receives the whole body
+	assert.EqualValues(t, payload, response.Body.String())
+	assert.EqualValues(t, 1, len(*entries))
+	entry := (*entries)[0]
+	assert.EqualValues(t, "request", entry.msg)
+	assert.EqualValues(t, http.MethodPost, entry.fields["method"])
+	assert.EqualValues(t, "/users/:id", entry.fields["route"])
+	assert.EqualValues(t, http.StatusCreated, entry.fields["status"])
+	assert.EqualValues(t, len(payload), entry.fields["bytes_in"])
+	assert.EqualValues(t, len(payload), entry.fields["bytes_out"])
+	assert.EqualValues(t, "192.0.2.1", entry.fields["client_ip"])
+	assert.EqualValues(t, "abc-123", entry.fields["request_id"])
+	assert.NotNil(t, entry.fields["latency"])
+
+	headers := entry.fields["headers"].(map[string]string)
+	assert.EqualValues(t, "[REDACTED]", headers["Authorization"])
+	assert.EqualValues(t, "[REDACTED]", headers["Cookie"])
+	assert.EqualValues(t, "application/json", headers["Content-Type"])
+	assert.EqualValues(t, `{"name":"x","nested":[{"Password":"[REDACTED]"}],"password":"[REDACTED]"}`, entry.fields["body"])
+}
+
+func TestAccessLogAlwaysRedactsGithubTokens(t *testing.T) {
+	entries := captureAccessLog(t, config.AccessLogConfig{Enabled: true})
+
+	request := httptest.NewRequest(http.MethodGet, "/marco", nil)
+	request.Header.Set("Authorization", "Bearer caller-token")
+	request.Header.Set("X-GitHub-Token", "caller-token")
+	request.Header.Set("Cookie", "github_session=abc")
+	accessLogRouter().ServeHTTP(httptest.NewRecorder(), request)
+
+	headers := (*entries)[0].fields["headers"].(map[string]string)
+	assert.EqualValues(t, "[REDACTED]", headers["Authorization"])
+	assert.EqualValues(t, "[REDACTED]", headers["X-Github-Token"])
+	assert.EqualValues(t, "[REDACTED]", headers["Cookie"])
+}
+
+func TestAccessLogSkipsLargeBodies(t *testing.T) {
+	entries := captureAccessLog(t, config.AccessLogConfig{Enabled: true, LogBody: true, MaxBodyBytes: 4})
+
+	request := httptest.NewRequest(http.MethodPost, "/users/42", strings.NewReader(`{"name":"too long"}`))
+	request.Header.Set("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+	accessLogRouter().ServeHTTP(response, request)
+
+	assert.EqualValues(t, `{"name":"too long"}`, response.Body.String())
+	assert.EqualValues(t, 1, len(*entries))
+	assert.Nil(t, (*entries)[0].fields["body"])
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	entries := captureAccessLog(t, config.AccessLogConfig{
+		Enabled:     true,
+		SampleRates: map[string]float64{"/marco": 0.25},
+	})
+	defer func() { sample = rand.Float64 }()
+
+	router := accessLogRouter()
+	for _, drawn := range []float64{0.1, 0.5, 0.9, 0.2} {
+		sample = func() float64 { return drawn }
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/marco", nil))
+	}
+	assert.EqualValues(t, 2, len(*entries))
+
+	//failed requests are always logged
+	sample = func() float64 { return 0.99 }
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	assert.EqualValues(t, 3, len(*entries))
+	assert.EqualValues(t, "unmatched", (*entries)[2].fields["route"])
+	assert.EqualValues(t, http.StatusNotFound, (*entries)[2].fields["status"])
+}
+
+func TestAccessLogDisabled(t *testing.T) {
+	entries := captureAccessLog(t, config.AccessLogConfig{Enabled: false})
+
+	accessLogRouter().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/marco", nil))
+
+	assert.EqualValues(t, 0, len(*entries))
+}
+
+func TestPanicsAreLoggedAndCounted(t *testing.T) {
+	entries := captureAccessLog(t, config.AccessLogConfig{Enabled: true})
+	//the order of app.mapURLs, the recovery runs inside the access log and the metrics
+	router := gin.New()
+	router.Use(RequestID, AccessLog, Metrics, gin.RecoveryWithWriter(ioutil.Discard))
+	router.GET("/panics", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/panics", nil))
+	assert.EqualValues(t, http.StatusInternalServerError, response.Code)
+	assert.EqualValues(t, 1, len(*entries))
+	assert.EqualValues(t, http.StatusInternalServerError, (*entries)[0].fields["status"])
+	assert.EqualValues(t, "/panics", (*entries)[0].fields["route"])
+
+	scraped := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(scraped, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, scraped.Body.String(), `api_http_requests_total{method="GET",route="/panics",status="500"} 1`)
+}
@@ -0,0 +1,24 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	clientIdentityKey = "client_identity"
+)
+
+//ClientIdentity stores the subject of the verified client certificate, if
+//any, so controllers can read it with GetClientIdentity.
+func ClientIdentity(c *gin.Context) {
+	if c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0 {
+		c.Set(clientIdentityKey, c.Request.TLS.VerifiedChains[0][0].Subject.String())
+	}
+	c.Next()
+}
+
+//GetClientIdentity returns the subject of the verified client certificate,
+//or an empty string when the client did not present one.
+func GetClientIdentity(c *gin.Context) string {
+	return c.GetString(clientIdentityKey)
+}
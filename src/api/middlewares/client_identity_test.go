@@ -0,0 +1,33 @@
+package middlewares
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jebo87/golang-microservices/src/api/utils/test_utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIdentityNoTLS(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/marco", nil)
+	c := test_utils.GetMockedContext(request, httptest.NewRecorder())
+
+	ClientIdentity(c)
+
+	assert.EqualValues(t, "", GetClientIdentity(c))
+}
+
+func TestClientIdentityVerifiedCertificate(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/marco", nil)
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "caller-service", Organization: []string{"platform"}}}
+	request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	c := test_utils.GetMockedContext(request, httptest.NewRecorder())
+
+	ClientIdentity(c)
+
+	assert.EqualValues(t, "CN=caller-service,O=platform", GetClientIdentity(c))
+}
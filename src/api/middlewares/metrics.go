@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jebo87/golang-microservices/src/api/metrics"
+)
+
+const (
+	unmatchedRoute = "unmatched"
+)
+
+//Metrics records the count and the latency of every request by route template and status.
+func Metrics(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		//keeps the cardinality bounded when clients hit random paths
+		route = unmatchedRoute
+	}
+	metrics.ObserveHTTPRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+}
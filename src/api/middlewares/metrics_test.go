@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jebo87/golang-microservices/src/api/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsUsesRouteTemplate(t *testing.T) {
+	router := gin.New()
+	router.Use(Metrics)
+	router.GET("/users/:id", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/random/path", nil))
+
+	response := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := ioutil.ReadAll(response.Body)
+	assert.Contains(t, string(body), `api_http_requests_total{method="GET",route="/users/:id",status="204"} 1`)
+	assert.Contains(t, string(body), `api_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.NotContains(t, string(body), "/users/42")
+}
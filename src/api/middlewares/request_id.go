@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jebo87/golang-microservices/src/api/log"
+	"github.com/jebo87/golang-microservices/src/api/utils/request_id"
+)
+
+//RequestID reuses the X-Request-ID sent by the client or generates a new one.
+//The id is stored in the request context, added to every log entry written
+//with that context and echoed in the response headers.
+func RequestID(c *gin.Context) {
+	id := c.GetHeader(request_id.Header)
+	if !request_id.IsValid(id) {
+		id = request_id.New()
+	}
+
+	ctx := request_id.NewContext(c.Request.Context(), id)
+	ctx = log.ContextWithFields(ctx, log.String("request_id", id))
+	c.Request = c.Request.WithContext(ctx)
+	c.Header(request_id.Header, id)
+	c.Next()
+}
+
+//GetRequestID returns the id of the request being handled.
+func GetRequestID(c *gin.Context) string {
+	return request_id.FromContext(c.Request.Context())
+}
@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jebo87/golang-microservices/src/api/log"
+	"github.com/jebo87/golang-microservices/src/api/utils/test_utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDKeepsClientID(t *testing.T) {
+	response := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/marco", nil)
+	request.Header.Set("X-Request-ID", "abc-123")
+	c := test_utils.GetMockedContext(request, response)
+
+	RequestID(c)
+
+	assert.EqualValues(t, "abc-123", GetRequestID(c))
+	assert.EqualValues(t, "abc-123", response.Header().Get("X-Request-ID"))
+	assert.EqualValues(t, []log.Field{log.String("request_id", "abc-123")}, log.FieldsFromContext(c.Request.Context()))
+}
+
+func TestRequestIDGeneratesMissingOrInvalidID(t *testing.T) {
+	for _, given := range []string{"", "has spaces", strings.Repeat("a", 200)} {
+		response := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/marco", nil)
+		request.Header.Set("X-Request-ID", given)
+		c := test_utils.GetMockedContext(request, response)
+
+		RequestID(c)
+
+		id := GetRequestID(c)
+		assert.EqualValues(t, 32, len(id))
+		assert.NotEqual(t, given, id)
+		assert.EqualValues(t, id, response.Header().Get("X-Request-ID"))
+	}
+}
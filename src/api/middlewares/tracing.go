@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jebo87/golang-microservices/src/api/log"
+	"github.com/jebo87/golang-microservices/src/api/tracing"
+	"github.com/jebo87/golang-microservices/src/api/utils/request_id"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serverName = "golang-microservices"
+)
+
+//Tracing starts a server span for every request, continuing the trace sent
+//by the caller in the traceparent header if any.
+func Tracing(c *gin.Context) {
+	route := c.FullPath()
+	if route == "" {
+		route = unmatchedRoute
+	}
+
+	ctx := tracing.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+	ctx, span := tracing.Start(ctx, c.Request.Method+" "+route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest(serverName, route, c.Request)...))
+	defer span.End()
+
+	if id := request_id.FromContext(ctx); id != "" {
+		span.SetAttributes(attribute.String("request_id", id))
+	}
+	if span.SpanContext().IsValid() {
+		ctx = log.ContextWithFields(ctx, log.String("trace_id", span.SpanContext().TraceID().String()))
+	}
+	c.Request = c.Request.WithContext(ctx)
+
+	c.Next()
+
+	status := c.Writer.Status()
+	span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+	span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(status))
+}
@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jebo87/golang-microservices/src/api/log"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingContinuesCallerTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	var fields []log.Field
+	router := gin.New()
+	router.Use(RequestID, Tracing)
+	router.GET("/users/:id", func(c *gin.Context) {
+		fields = log.FieldsFromContext(c.Request.Context())
+		c.Status(http.StatusInternalServerError)
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := recorder.Ended()
+	assert.EqualValues(t, 1, len(spans))
+	assert.EqualValues(t, "GET /users/:id", spans[0].Name())
+	assert.EqualValues(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	assert.EqualValues(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+	assert.EqualValues(t, "Error", spans[0].Status().Code.String())
+	assert.Contains(t, fields, log.String("trace_id", "4bf92f3577b34da6a3ce929d0e0e4736"))
+}
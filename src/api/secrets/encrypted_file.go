@@ -0,0 +1,65 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+//NewEncryptedFileProvider reads a secret encrypted with Encrypt from path.
+//The key must be 16, 24 or 32 bytes long (AES-128, AES-192 or AES-256).
+func NewEncryptedFileProvider(path string, key []byte) (SecretProvider, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &fileProvider{
+		path: path,
+		decode: func(content []byte) (string, error) {
+			return decrypt(aead, content)
+		},
+	}, nil
+}
+
+//Encrypt returns the base64 encoded AES-GCM encryption of secret, in the
+//format expected by the encrypted file provider.
+func Encrypt(key []byte, secret string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.New("invalid encryption key, it must be 16, 24 or 32 bytes long")
+	}
+	return cipher.NewGCM(block)
+}
+
+func decrypt(aead cipher.AEAD, content []byte) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(content)))
+	if err != nil {
+		return "", errors.New("content is not valid base64")
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("content is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("unable to decrypt content")
+	}
+	return string(bytes.TrimSpace(plain)), nil
+}
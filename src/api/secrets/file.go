@@ -0,0 +1,67 @@
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+//fileProvider reads a secret from a file, typically mounted by an orchestrator.
+//The file is read again whenever its modification time or size changes, which
+//covers the symlink swap done by kubernetes when a secret is rotated.
+type fileProvider struct {
+	path   string
+	decode func([]byte) (string, error)
+
+	mutex   sync.Mutex
+	modTime time.Time
+	size    int64
+	value   string
+}
+
+//NewFileProvider reads the secret as plain text from path.
+func NewFileProvider(path string) SecretProvider {
+	return &fileProvider{
+		path: path,
+		decode: func(content []byte) (string, error) {
+			return string(bytes.TrimSpace(content)), nil
+		},
+	}
+}
+
+func (p *fileProvider) Secret() (string, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("%w: file %s does not exist", ErrSecretNotFound, p.path)
+		}
+		return "", fmt.Errorf("error reading secret file %s: %s", p.path, err)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.value != "" && info.ModTime().Equal(p.modTime) && info.Size() == p.size {
+		return p.value, nil
+	}
+
+	content, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return "", fmt.Errorf("error reading secret file %s: %s", p.path, err)
+	}
+	value, err := p.decode(content)
+	if err != nil {
+		return "", fmt.Errorf("error decoding secret file %s: %s", p.path, err)
+	}
+	if value == "" {
+		return "", fmt.Errorf("%w: file %s is empty", ErrSecretNotFound, p.path)
+	}
+
+	p.value = value
+	p.modTime = info.ModTime()
+	p.size = info.Size()
+	return value, nil
+}
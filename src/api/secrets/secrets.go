@@ -0,0 +1,104 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jebo87/golang-microservices/src/api/config"
+)
+
+//SecretProvider returns the current value of a secret. Implementations
+//must pick up rotated values without a restart.
+type SecretProvider interface {
+	Secret() (string, error)
+}
+
+//ContextSecretProvider is a SecretProvider that fetches its secret with the
+//context of the caller, so it is cancelled and traced along with the request.
+type ContextSecretProvider interface {
+	SecretProvider
+	SecretContext(ctx context.Context) (string, error)
+}
+
+var (
+	ErrSecretNotFound = errors.New("secret not found")
+
+	//GithubToken provides the access token used to call the github api.
+	GithubToken SecretProvider
+)
+
+func init() {
+	GithubToken = NewEnvProvider(config.Get().Github.Token.Env)
+}
+
+//Configure replaces GithubToken with the provider described in the configuration.
+func Configure(cfg config.TokenConfig) error {
+	provider, err := New(cfg)
+	if err != nil {
+		return err
+	}
+	GithubToken = provider
+	return nil
+}
+
+//SecretContext returns the secret of provider, fetched with ctx when provider
+//is a ContextSecretProvider.
+func SecretContext(ctx context.Context, provider SecretProvider) (string, error) {
+	if p, ok := provider.(ContextSecretProvider); ok {
+		return p.SecretContext(ctx)
+	}
+	return provider.Secret()
+}
+
+//New builds the SecretProvider described in the configuration.
+func New(cfg config.TokenConfig) (SecretProvider, error) {
+	switch cfg.Provider {
+	case config.TokenProviderEnv:
+		return NewEnvProvider(cfg.Env), nil
+	case config.TokenProviderFile:
+		return NewFileProvider(cfg.File), nil
+	case config.TokenProviderEncryptedFile:
+		key, err := base64.StdEncoding.DecodeString(cfg.Key)
+		if err != nil {
+			return nil, errors.New("github.token.key is not valid base64")
+		}
+		return NewEncryptedFileProvider(cfg.File, key)
+	}
+	return nil, fmt.Errorf("unknown secret provider %q", cfg.Provider)
+}
+
+type envProvider struct {
+	name string
+}
+
+//NewEnvProvider reads the secret from the given environment variable on every call.
+func NewEnvProvider(name string) SecretProvider {
+	return &envProvider{name: name}
+}
+
+func (p *envProvider) Secret() (string, error) {
+	value, ok := os.LookupEnv(p.name)
+	if !ok || value == "" {
+		return "", fmt.Errorf("%w: environment variable %s is not set", ErrSecretNotFound, p.name)
+	}
+	return value, nil
+}
+
+type staticProvider struct {
+	value string
+}
+
+//NewStaticProvider always returns the given value, useful for tests.
+func NewStaticProvider(value string) SecretProvider {
+	return &staticProvider{value: value}
+}
+
+func (p *staticProvider) Secret() (string, error) {
+	if p.value == "" {
+		return "", ErrSecretNotFound
+	}
+	return p.value, nil
+}
@@ -0,0 +1,137 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/stretchr/testify/assert"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func tempFile(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "secrets")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "token")
+}
+
+//rotate writes a new value and moves the modification time forward so the
+//change is noticed even on file systems with a coarse timestamp resolution.
+func rotate(t *testing.T, path string, content string, age int) {
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0600))
+	when := time.Now().Add(time.Duration(age) * time.Second)
+	assert.Nil(t, os.Chtimes(path, when, when))
+}
+
+func TestEnvProvider(t *testing.T) {
+	os.Setenv("TEST_SECRET_TOKEN", "abc123")
+	defer os.Unsetenv("TEST_SECRET_TOKEN")
+
+	value, err := NewEnvProvider("TEST_SECRET_TOKEN").Secret()
+	assert.Nil(t, err)
+	assert.EqualValues(t, "abc123", value)
+
+	_, err = NewEnvProvider("TEST_SECRET_MISSING").Secret()
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+}
+
+func TestFileProviderRotation(t *testing.T) {
+	path := tempFile(t)
+	rotate(t, path, "first\n", -10)
+	provider := NewFileProvider(path)
+
+	value, err := provider.Secret()
+	assert.Nil(t, err)
+	assert.EqualValues(t, "first", value)
+
+	rotate(t, path, "second\n", 0)
+	value, err = provider.Secret()
+	assert.Nil(t, err)
+	assert.EqualValues(t, "second", value)
+}
+
+func TestFileProviderMissingFile(t *testing.T) {
+	_, err := NewFileProvider(tempFile(t)).Secret()
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+}
+
+func TestEncryptedFileProvider(t *testing.T) {
+	path := tempFile(t)
+	encrypted, err := Encrypt(testKey, "first")
+	assert.Nil(t, err)
+	rotate(t, path, encrypted, -10)
+
+	provider, err := NewEncryptedFileProvider(path, testKey)
+	assert.Nil(t, err)
+	value, err := provider.Secret()
+	assert.Nil(t, err)
+	assert.EqualValues(t, "first", value)
+
+	encrypted, err = Encrypt(testKey, "second")
+	assert.Nil(t, err)
+	rotate(t, path, encrypted, 0)
+	value, err = provider.Secret()
+	assert.Nil(t, err)
+	assert.EqualValues(t, "second", value)
+}
+
+func TestEncryptedFileProviderWrongKey(t *testing.T) {
+	path := tempFile(t)
+	encrypted, err := Encrypt(testKey, "s3cr3t-value")
+	assert.Nil(t, err)
+	rotate(t, path, encrypted, 0)
+
+	provider, err := NewEncryptedFileProvider(path, []byte("fedcba9876543210fedcba9876543210"))
+	assert.Nil(t, err)
+	value, err := provider.Secret()
+	assert.EqualValues(t, "", value)
+	assert.NotNil(t, err)
+	assert.NotContains(t, err.Error(), "s3cr3t-value")
+}
+
+func TestNewFromConfig(t *testing.T) {
+	provider, err := New(config.TokenConfig{
+		Provider: config.TokenProviderEncryptedFile,
+		File:     tempFile(t),
+		Key:      base64.StdEncoding.EncodeToString(testKey),
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, provider)
+
+	_, err = New(config.TokenConfig{Provider: config.TokenProviderEncryptedFile, Key: "not base64!"})
+	assert.NotNil(t, err)
+
+	_, err = New(config.TokenConfig{Provider: "vault"})
+	assert.NotNil(t, err)
+}
+
+type ctxKey struct{}
+
+type contextProvider struct{}
+
+func (contextProvider) Secret() (string, error) {
+	return "", errors.New("the context was not passed")
+}
+
+func (contextProvider) SecretContext(ctx context.Context) (string, error) {
+	return ctx.Value(ctxKey{}).(string), nil
+}
+
+func TestSecretContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), ctxKey{}, "from the context")
+	secret, err := SecretContext(ctx, contextProvider{})
+	assert.Nil(t, err)
+	assert.EqualValues(t, "from the context", secret)
+
+	secret, err = SecretContext(ctx, NewStaticProvider("static"))
+	assert.Nil(t, err)
+	assert.EqualValues(t, "static", secret)
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/jebo87/golang-microservices/src/api/domain/github/providers/github_provider"
+	"github.com/jebo87/golang-microservices/src/api/log"
+	"github.com/jebo87/golang-microservices/src/api/sessions"
+	"github.com/jebo87/golang-microservices/src/api/utils/errors"
+)
+
+//pendingLogin is a login started but not completed yet, found by its state.
+type pendingLogin struct {
+	verifier  string
+	expiresAt time.Time
+}
+
+type loginService struct {
+	mutex  sync.Mutex
+	logins map[string]pendingLogin
+}
+
+type loginServiceInterface interface {
+	Start(ctx context.Context) (authorizeURL string, state string, err errors.ApiError)
+	Complete(ctx context.Context, state string, code string) (sessionID string, session sessions.Session, err errors.ApiError)
+}
+
+var (
+	LoginService loginServiceInterface
+
+	//now is swapped by tests to expire the logins.
+	now = time.Now
+)
+
+func init() {
+	LoginService = &loginService{logins: make(map[string]pendingLogin)}
+}
+
+//Start begins the github oauth web flow. It returns the url of github the
+//user is sent to and the state github sends back to the callback. The PKCE
+//verifier stays on the server.
+func (s *loginService) Start(ctx context.Context) (string, string, errors.ApiError) {
+	cfg := config.Get().Github.OAuth
+	if cfg.ClientID == "" {
+		return "", "", errors.NewNotFoundApiError("github login is disabled")
+	}
+	state, err := sessions.NewID()
+	if err != nil {
+		log.ErrorContext(ctx, "error generating the oauth state", err)
+		return "", "", errors.NewInternalServerError("error starting the github login")
+	}
+	verifier, err := sessions.NewID()
+	if err != nil {
+		log.ErrorContext(ctx, "error generating the oauth verifier", err)
+		return "", "", errors.NewInternalServerError("error starting the github login")
+	}
+	s.save(state, pendingLogin{verifier: verifier, expiresAt: now().Add(cfg.LoginTTL.Duration)})
+
+	challenge := sha256.Sum256([]byte(verifier))
+	//validated as an absolute url with the configuration
+	authorize, _ := url.Parse(cfg.AuthorizeURL)
+	query := authorize.Query()
+	query.Set("client_id", cfg.ClientID)
+	query.Set("redirect_uri", cfg.RedirectURL)
+	query.Set("scope", strings.Join(cfg.Scopes, " "))
+	query.Set("state", state)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	authorize.RawQuery = query.Encode()
+	return authorize.String(), state, nil
+}
+
+//Complete ends the login of state, exchanging code for the token of the user
+//and storing it in a new session. A state can only be used once.
+func (s *loginService) Complete(ctx context.Context, state string, code string) (string, sessions.Session, errors.ApiError) {
+	cfg := config.Get().Github.OAuth
+	if cfg.ClientID == "" {
+		return "", sessions.Session{}, errors.NewNotFoundApiError("github login is disabled")
+	}
+	login, ok := s.take(state)
+	if !ok {
+		return "", sessions.Session{}, errors.NewBadRequestError("unknown or expired github login, log in again")
+	}
+	if code == "" {
+		return "", sessions.Session{}, errors.NewBadRequestError("missing oauth code")
+	}
+
+	token, ghErr := github_provider.ExchangeCode(ctx, code, login.verifier)
+	if ghErr != nil {
+		return "", sessions.Session{}, errors.NewApiError(ghErr.StatusCode, ghErr.Message)
+	}
+	id, err := sessions.NewID()
+	if err != nil {
+		log.ErrorContext(ctx, "error generating the session id", err)
+		return "", sessions.Session{}, errors.NewInternalServerError("error completing the github login")
+	}
+	session := sessions.Session{GithubToken: token, ExpiresAt: now().Add(cfg.SessionTTL.Duration)}
+	sessions.Default.Set(id, session)
+	log.InfoContext(ctx, "github login completed")
+	return id, session, nil
+}
+
+//save stores login, dropping the logins that expired.
+func (s *loginService) save(state string, login pendingLogin) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for other, pending := range s.logins {
+		if !now().Before(pending.expiresAt) {
+			delete(s.logins, other)
+		}
+	}
+	s.logins[state] = login
+}
+
+func (s *loginService) take(state string) (pendingLogin, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	login, ok := s.logins[state]
+	delete(s.logins, state)
+	return login, ok && now().Before(login.expiresAt)
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginExpires(t *testing.T) {
+	previous := config.Get()
+	cfg := config.Default()
+	cfg.Github.OAuth.ClientID = "client-id"
+	cfg.Github.OAuth.RedirectURL = "https://api.example.com/auth/github/callback"
+	config.Set(cfg)
+	start := time.Now()
+	now = func() time.Time { return start }
+	defer func() {
+		config.Set(previous)
+		now = time.Now
+	}()
+
+	authorizeURL, state, err := LoginService.Start(context.Background())
+	assert.Nil(t, err)
+	authorize, _ := url.Parse(authorizeURL)
+	assert.EqualValues(t, "github.com", authorize.Host)
+	assert.EqualValues(t, state, authorize.Query().Get("state"))
+	assert.EqualValues(t, "S256", authorize.Query().Get("code_challenge_method"))
+	assert.NotEmpty(t, authorize.Query().Get("code_challenge"))
+
+	now = func() time.Time { return start.Add(10 * time.Minute) }
+	_, _, err = LoginService.Complete(context.Background(), state, "code")
+	assert.EqualValues(t, http.StatusBadRequest, err.Status())
+	assert.EqualValues(t, "unknown or expired github login, log in again", err.Message())
+}
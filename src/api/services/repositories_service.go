@@ -1,7 +1,7 @@
 package services
 
 import (
-	"log"
+	"context"
 	"net/http"
 	"sync"
 
@@ -9,14 +9,21 @@ import (
 	"github.com/jebo87/golang-microservices/src/api/domain/github"
 	"github.com/jebo87/golang-microservices/src/api/domain/github/providers/github_provider"
 	"github.com/jebo87/golang-microservices/src/api/domain/repositories"
+	"github.com/jebo87/golang-microservices/src/api/log"
+	"github.com/jebo87/golang-microservices/src/api/metrics"
+	"github.com/jebo87/golang-microservices/src/api/secrets"
+	"github.com/jebo87/golang-microservices/src/api/tracing"
 	"github.com/jebo87/golang-microservices/src/api/utils/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type reposService struct{}
 
 type repoServiceInterface interface {
-	CreateRepo(request repositories.CreateRepoRequest) (*repositories.CreateRepoResponse, errors.ApiError)
-	CreateRepos(request []repositories.CreateRepoRequest) repositories.CreateReposResponse
+	CreateRepo(ctx context.Context, githubToken string, request repositories.CreateRepoRequest) (*repositories.CreateRepoResponse, errors.ApiError)
+	CreateRepos(ctx context.Context, githubToken string, request []repositories.CreateRepoRequest) repositories.CreateReposResponse
 }
 
 var (
@@ -27,9 +34,14 @@ func init() {
 	RepositoryService = &reposService{}
 }
 
-func (s *reposService) CreateRepo(input repositories.CreateRepoRequest) (*repositories.CreateRepoResponse, errors.ApiError) {
-	log.Println(config.GetGithubAccessToken())
+//CreateRepo creates the repository with githubToken, the token of the caller,
+//or with the token of the server when it is empty.
+func (s *reposService) CreateRepo(ctx context.Context, githubToken string, input repositories.CreateRepoRequest) (*repositories.CreateRepoResponse, errors.ApiError) {
+	ctx, span := tracing.Start(ctx, "RepositoryService.CreateRepo", trace.WithAttributes(attribute.String("repository.name", input.Name)))
+	defer span.End()
+
 	if err := input.Validate(); err != nil {
+		span.SetStatus(codes.Error, err.Message())
 		return nil, err
 	}
 
@@ -39,8 +51,27 @@ func (s *reposService) CreateRepo(input repositories.CreateRepoRequest) (*reposi
 		Description: input.Description,
 	}
 
-	response, err := github_provider.CreateRepo(config.GetGithubAccessToken(), request)
+	token, tokenErr := accessToken(ctx, githubToken)
+	if tokenErr != nil {
+		log.ErrorContext(ctx, "error getting the github access token", tokenErr)
+		span.SetStatus(codes.Error, "github access token is not available")
+		return nil, errors.NewInternalServerError("github access token is not available")
+	}
+
+	if githubToken != "" {
+		ctx = github_provider.ContextWithCallerToken(ctx)
+	}
+	var response *github.CreateRepoResponse
+	var err *github.GithubErrorResponse
+	if cfg := config.Get().Github; githubToken == "" && cfg.Auth == config.GithubAuthApp {
+		//the installation tokens of the app have no user to own the repository
+		response, err = github_provider.CreateOrgRepo(ctx, token, cfg.App.Org, request)
+	} else {
+		response, err = github_provider.CreateRepo(ctx, token, request)
+	}
 	if err != nil {
+		log.WarnContext(ctx, "repository not created", log.String("name", input.Name), log.Int("status", err.StatusCode))
+		span.SetStatus(codes.Error, err.Message)
 		return nil, errors.NewApiError(err.StatusCode, err.Message)
 	}
 
@@ -53,7 +84,28 @@ func (s *reposService) CreateRepo(input repositories.CreateRepoRequest) (*reposi
 
 }
 
-func (s *reposService) CreateRepos(requests []repositories.CreateRepoRequest) repositories.CreateReposResponse {
+//accessToken returns the token of the caller or, when none was given, the
+//token of the server, fetched with ctx. Neither is ever logged.
+func accessToken(ctx context.Context, callerToken string) (string, error) {
+	if callerToken != "" {
+		return callerToken, nil
+	}
+	return secrets.SecretContext(ctx, secrets.GithubToken)
+}
+
+func (s *reposService) CreateRepos(ctx context.Context, githubToken string, requests []repositories.CreateRepoRequest) repositories.CreateReposResponse {
+	ctx, span := tracing.Start(ctx, "RepositoryService.CreateRepos", trace.WithAttributes(attribute.Int("batch.size", len(requests))))
+	defer span.End()
+
+	if len(requests) == 0 {
+		err := errors.NewBadRequestError("no repositories to create")
+		span.SetStatus(codes.Error, err.Message())
+		return repositories.CreateReposResponse{
+			StatusCode: err.Status(),
+			Results:    []repositories.CreateRepositoriesResult{{Error: err}},
+		}
+	}
+
 	input := make(chan repositories.CreateRepositoriesResult)
 	output := make(chan repositories.CreateReposResponse)
 	defer close(output)
@@ -61,9 +113,15 @@ func (s *reposService) CreateRepos(requests []repositories.CreateRepoRequest) re
 	var wg sync.WaitGroup
 	go s.handleRepoResults(&wg, input, output)
 
+	//read on every batch so a new limit applies without a restart
+	limit := make(chan struct{}, config.Get().Github.MaxConcurrency)
 	for _, current := range requests {
 		wg.Add(1)
-		go s.createRepoConcurrent(current, input)
+		go func(request repositories.CreateRepoRequest) {
+			limit <- struct{}{}
+			defer func() { <-limit }()
+			s.createRepoConcurrent(ctx, githubToken, request, input)
+		}(current)
 	}
 	wg.Wait()
 	close(input)
@@ -76,13 +134,19 @@ func (s *reposService) CreateRepos(requests []repositories.CreateRepoRequest) re
 		}
 	}
 
+	outcome := metrics.OutcomePartial
 	if successfullCreations == 0 {
 		result.StatusCode = result.Results[0].Error.Status()
+		outcome = metrics.OutcomeFailure
 	} else if successfullCreations == len(requests) {
 		result.StatusCode = http.StatusCreated
+		outcome = metrics.OutcomeSuccess
 	} else {
 		result.StatusCode = http.StatusPartialContent
 	}
+	metrics.ObserveBatch(len(requests), outcome)
+	span.SetAttributes(attribute.String("batch.outcome", outcome))
+	log.InfoContext(ctx, "repositories batch processed", log.Int("requested", len(requests)), log.Int("created", successfullCreations), log.Int("status", result.StatusCode))
 
 	return result
 
@@ -102,13 +166,16 @@ func (s *reposService) handleRepoResults(wg *sync.WaitGroup, input chan reposito
 	output <- results
 }
 
-func (s *reposService) createRepoConcurrent(input repositories.CreateRepoRequest, output chan repositories.CreateRepositoriesResult) {
+func (s *reposService) createRepoConcurrent(ctx context.Context, githubToken string, input repositories.CreateRepoRequest, output chan repositories.CreateRepositoriesResult) {
+	ctx, span := tracing.Start(ctx, "RepositoryService.CreateRepos item", trace.WithAttributes(attribute.String("repository.name", input.Name)))
+	defer span.End()
+
 	if err := input.Validate(); err != nil {
 		output <- repositories.CreateRepositoriesResult{Error: err}
 		return
 	}
 
-	result, err := s.CreateRepo(input)
+	result, err := s.CreateRepo(ctx, githubToken, input)
 
 	if err != nil {
 		output <- repositories.CreateRepositoriesResult{Error: err}
@@ -1,32 +1,43 @@
 package services
 
 import (
-	"encoding/json"
-	"io/ioutil"
-	"log"
+	"context"
 	"net/http"
 	"os"
-	"strings"
 	"sync"
 	"testing"
 
 	"github.com/jebo87/golang-microservices/src/api/clients/restclient"
+	"github.com/jebo87/golang-microservices/src/api/config"
 	"github.com/jebo87/golang-microservices/src/api/domain/repositories"
+	"github.com/jebo87/golang-microservices/src/api/secrets"
+	"github.com/jebo87/golang-microservices/src/api/utils/cassette"
 	"github.com/jebo87/golang-microservices/src/api/utils/errors"
 	"github.com/jebo87/golang-microservices/src/api/utils/mocks"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestMain(m *testing.M) {
-	restclient.StartMockups()
+	secrets.GithubToken = secrets.NewStaticProvider("test-token")
 
 	os.Exit(m.Run())
 }
 
+//useTransport returns a fake github owned by the test, and the context sending
+//the calls to it with their own breakers, rate limiters and cache.
+func useTransport() (*mocks.Transport, context.Context) {
+	transport := mocks.NewTransport()
+	return transport, restclient.ContextWithClient(context.Background(), transport)
+}
+
 func TestCreateRepoInvalidInputName(t *testing.T) {
+	t.Parallel()
 	request := repositories.CreateRepoRequest{}
 
-	result, err := RepositoryService.CreateRepo(request)
+	result, err := RepositoryService.CreateRepo(context.Background(), "", request)
 
 	assert.Nil(t, result)
 	assert.NotNil(t, err)
@@ -34,21 +45,67 @@ func TestCreateRepoInvalidInputName(t *testing.T) {
 	assert.EqualValues(t, "invalid repository name", err.Message())
 }
 
+func TestCreateRepoNoAccessToken(t *testing.T) {
+	secrets.GithubToken = secrets.NewStaticProvider("")
+	defer func() { secrets.GithubToken = secrets.NewStaticProvider("test-token") }()
+
+	result, err := RepositoryService.CreateRepo(context.Background(), "", repositories.CreateRepoRequest{Name: "golang-example"})
+
+	assert.Nil(t, result)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusInternalServerError, err.Status())
+	assert.EqualValues(t, "github access token is not available", err.Message())
+}
+
+func TestCreateRepoWithCallerToken(t *testing.T) {
+	secrets.GithubToken = secrets.NewStaticProvider("")
+	defer func() { secrets.GithubToken = secrets.NewStaticProvider("test-token") }()
+	transport, ctx := useTransport()
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/user/repos")).
+		RespondJSON(http.StatusCreated, map[string]interface{}{"id": 123, "name": "golang-example", "owner": map[string]string{"login": "caller"}})
+
+	result, err := RepositoryService.CreateRepo(ctx, "caller-token", repositories.CreateRepoRequest{Name: "golang-example"})
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "caller", result.Owner)
+	transport.AssertCalled(t, mocks.Match(http.MethodPost, "https://api.github.com/user/repos").Header("Authorization", "token caller-token"), 1)
+}
+
+func TestCreateRepoAsGithubApp(t *testing.T) {
+	previous := config.Get()
+	cfg := config.Default()
+	cfg.Github.Auth = config.GithubAuthApp
+	cfg.Github.App.Org = "jebo-org"
+	config.Set(cfg)
+	defer config.Set(previous)
+	secrets.GithubToken = secrets.NewStaticProvider("ghs_installation")
+	defer func() { secrets.GithubToken = secrets.NewStaticProvider("test-token") }()
+	transport, ctx := useTransport()
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/orgs/jebo-org/repos")).
+		RespondJSON(http.StatusCreated, map[string]interface{}{"id": 123, "name": "golang-example", "owner": map[string]string{"login": "jebo-org"}})
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/user/repos")).
+		RespondJSON(http.StatusCreated, map[string]interface{}{"id": 124, "name": "golang-example", "owner": map[string]string{"login": "caller"}})
+
+	result, err := RepositoryService.CreateRepo(ctx, "", repositories.CreateRepoRequest{Name: "golang-example"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, "jebo-org", result.Owner)
+	transport.AssertCalled(t, mocks.Match(http.MethodPost, "https://api.github.com/orgs/jebo-org/repos").Header("Authorization", "token ghs_installation"), 1)
+
+	//the token of a caller is still a user token
+	result, err = RepositoryService.CreateRepo(ctx, "caller-token", repositories.CreateRepoRequest{Name: "golang-example"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, "caller", result.Owner)
+}
+
 func TestCreateRepoErrorFromGithub(t *testing.T) {
-	restclient.FlushMockups()
-	restclient.AddMockup(restclient.Mock{
-		Url:        "https://api.github.com/user/repos",
-		HttpMethod: http.MethodPost,
-		Response: &http.Response{
-			StatusCode: http.StatusUnauthorized,
-			Body:       ioutil.NopCloser(strings.NewReader(`{"message": "Requires authentication","documentation_url": "https://docs.github.com/rest/reference/repos#create-a-repository-for-the-authenticated-user"}`)),
-		},
-	})
+	t.Parallel()
+	transport, ctx := useTransport()
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/user/repos")).Respond(http.StatusUnauthorized, `{"message": "Requires authentication","documentation_url": "https://docs.github.com/rest/reference/repos#create-a-repository-for-the-authenticated-user"}`)
 	request := repositories.CreateRepoRequest{
 		Name: "golang-example",
 	}
 
-	result, err := RepositoryService.CreateRepo(request)
+	result, err := RepositoryService.CreateRepo(ctx, "", request)
 
 	assert.Nil(t, result)
 	assert.NotNil(t, err)
@@ -58,22 +115,16 @@ func TestCreateRepoErrorFromGithub(t *testing.T) {
 }
 
 func TestCreateRepoNoError(t *testing.T) {
-	restclient.FlushMockups()
-	restclient.AddMockup(restclient.Mock{
-		Url:        "https://api.github.com/user/repos",
-		HttpMethod: http.MethodPost,
-		Response: &http.Response{
-			StatusCode: http.StatusCreated,
-			Body:       ioutil.NopCloser(strings.NewReader(`{"id": 123,"name": "golang-example","description":"This is the description","owner":{"login":"jebo87"}}`)),
-		},
-	})
+	t.Parallel()
+	transport, ctx := useTransport()
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/user/repos")).Respond(http.StatusCreated, `{"id": 123,"name": "golang-example","description":"This is the description","owner":{"login":"jebo87"}}`)
 
 	request := repositories.CreateRepoRequest{
 		Name:        "golang-example",
 		Description: "This is the description",
 	}
 
-	result, err := RepositoryService.CreateRepo(request)
+	result, err := RepositoryService.CreateRepo(ctx, "", request)
 
 	assert.Nil(t, err)
 	assert.NotNil(t, result)
@@ -83,6 +134,7 @@ func TestCreateRepoNoError(t *testing.T) {
 }
 
 func TestRepoConcurrent(t *testing.T) {
+	t.Parallel()
 	request := repositories.CreateRepoRequest{}
 	output := make(chan repositories.CreateRepositoriesResult)
 	defer close(output)
@@ -90,7 +142,7 @@ func TestRepoConcurrent(t *testing.T) {
 	service := reposService{}
 
 	//we have to do it in a go rutine, otherwise will block
-	go service.createRepoConcurrent(request, output)
+	go service.createRepoConcurrent(context.Background(), "", request, output)
 
 	//blocks until we get an output.
 	result := <-output
@@ -103,15 +155,9 @@ func TestRepoConcurrent(t *testing.T) {
 }
 
 func TestRepoConcurrentErrorGithub(t *testing.T) {
-	restclient.FlushMockups()
-	restclient.AddMockup(restclient.Mock{
-		Url:        "https://api.github.com/user/repos",
-		HttpMethod: http.MethodPost,
-		Response: &http.Response{
-			StatusCode: http.StatusUnauthorized,
-			Body:       ioutil.NopCloser(strings.NewReader(`{"message": "Requires authentication","documentation_url": "https://docs.github.com/rest/reference/repos#create-a-repository-for-the-authenticated-user"}`)),
-		},
-	})
+	t.Parallel()
+	transport, ctx := useTransport()
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/user/repos")).Respond(http.StatusUnauthorized, `{"message": "Requires authentication","documentation_url": "https://docs.github.com/rest/reference/repos#create-a-repository-for-the-authenticated-user"}`)
 	request := repositories.CreateRepoRequest{Name: "testing"}
 	output := make(chan repositories.CreateRepositoriesResult)
 	defer close(output)
@@ -119,7 +165,7 @@ func TestRepoConcurrentErrorGithub(t *testing.T) {
 	service := reposService{}
 
 	//we have to do it in a go rutine, otherwise will block
-	go service.createRepoConcurrent(request, output)
+	go service.createRepoConcurrent(ctx, "", request, output)
 
 	//blocks until we get an output.
 	result := <-output
@@ -132,15 +178,9 @@ func TestRepoConcurrentErrorGithub(t *testing.T) {
 }
 
 func TestRepoConcurrentNoError(t *testing.T) {
-	restclient.FlushMockups()
-	restclient.AddMockup(restclient.Mock{
-		Url:        "https://api.github.com/user/repos",
-		HttpMethod: http.MethodPost,
-		Response: &http.Response{
-			StatusCode: http.StatusCreated,
-			Body:       ioutil.NopCloser(strings.NewReader(`{"id": 123,"name": "golang-example","description":"This is the description","owner":{"login":"jebo87"}}`)),
-		},
-	})
+	t.Parallel()
+	transport, ctx := useTransport()
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/user/repos")).Respond(http.StatusCreated, `{"id": 123,"name": "golang-example","description":"This is the description","owner":{"login":"jebo87"}}`)
 
 	request := repositories.CreateRepoRequest{
 		Name:        "golang-example",
@@ -152,7 +192,7 @@ func TestRepoConcurrentNoError(t *testing.T) {
 	service := reposService{}
 
 	//we have to do it in a go rutine, otherwise will block
-	go service.createRepoConcurrent(request, output)
+	go service.createRepoConcurrent(ctx, "", request, output)
 
 	//blocks until we get an output.
 	result := <-output
@@ -165,6 +205,7 @@ func TestRepoConcurrentNoError(t *testing.T) {
 }
 
 func TestHandleRepoResults(t *testing.T) {
+	t.Parallel()
 	input := make(chan repositories.CreateRepositoriesResult)
 	output := make(chan repositories.CreateReposResponse)
 	defer close(output)
@@ -194,6 +235,7 @@ func TestHandleRepoResults(t *testing.T) {
 }
 
 func TestCreateReposBadRequestsAllFail(t *testing.T) {
+	t.Parallel()
 
 	//no need to add mockups since the requests wil fail
 	//when validating the names
@@ -204,7 +246,7 @@ func TestCreateReposBadRequestsAllFail(t *testing.T) {
 			Name: "   ",
 		},
 	}
-	result := RepositoryService.CreateRepos(requests)
+	result := RepositoryService.CreateRepos(context.Background(), "", requests)
 	assert.NotNil(t, result)
 
 	assert.EqualValues(t, http.StatusBadRequest, result.StatusCode)
@@ -218,24 +260,26 @@ func TestCreateReposBadRequestsAllFail(t *testing.T) {
 
 }
 
-func TestCreateReposOneFail(t *testing.T) {
+func TestCreateReposEmptyBatch(t *testing.T) {
+	t.Parallel()
+	result := RepositoryService.CreateRepos(context.Background(), "", nil)
 
-	restclient.FlushMockups()
-	restclient.AddMockup(restclient.Mock{
-		Url:        "https://api.github.com/user/repos",
-		HttpMethod: http.MethodPost,
-		Response: &http.Response{
-			StatusCode: http.StatusCreated,
-			Body:       ioutil.NopCloser(strings.NewReader(`{"id": 123,"name": "golang-example","description":"This is the description","owner":{"login":"jebo87"}}`)),
-		},
-	})
+	assert.EqualValues(t, http.StatusBadRequest, result.StatusCode)
+	assert.EqualValues(t, 1, len(result.Results))
+	assert.EqualValues(t, "no repositories to create", result.Results[0].Error.Message())
+}
+
+func TestCreateReposOneFail(t *testing.T) {
+	t.Parallel()
+	transport, ctx := useTransport()
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/user/repos")).Respond(http.StatusCreated, `{"id": 123,"name": "golang-example","description":"This is the description","owner":{"login":"jebo87"}}`)
 	requests := []repositories.CreateRepoRequest{
 		{},
 		{
 			Name: "golang-example",
 		},
 	}
-	result := RepositoryService.CreateRepos(requests)
+	result := RepositoryService.CreateRepos(ctx, "", requests)
 	assert.NotNil(t, result)
 
 	assert.EqualValues(t, http.StatusPartialContent, result.StatusCode)
@@ -257,33 +301,21 @@ func TestCreateReposOneFail(t *testing.T) {
 }
 
 func TestCreateReposAllSuccess(t *testing.T) {
-
-	restclient.FlushMockups()
-
-	//Use the mock client to support multiple requests
-	restclient.StopMockups()
-	restclient.Client = &mocks.MockClient{}
-
-	mocks.DoFunc = func(*http.Request) (*http.Response, error) {
-		r := ioutil.NopCloser(strings.NewReader(`{"id": 123,"name": "testing","description":"This is the description","owner":{"login":"jebo87"}}`))
-
-		return &http.Response{
-			StatusCode: 200,
-			Body:       r,
-		}, nil
-	}
+	t.Parallel()
+	//the transport answers every request with the same repository
+	transport, ctx := useTransport()
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/user/repos")).
+		Respond(http.StatusOK, `{"id": 123,"name": "testing","description":"This is the description","owner":{"login":"jebo87"}}`)
 	requests := []repositories.CreateRepoRequest{
 		{Name: "testing"},
 		{Name: "testing"},
 		{Name: "testing"},
 	}
-	result := RepositoryService.CreateRepos(requests)
+	result := RepositoryService.CreateRepos(ctx, "", requests)
 	assert.NotNil(t, result)
 
 	// assert.EqualValues(t, http.StatusCreated, result.StatusCode)
 	// assert.EqualValues(t, 2, len(result.Results))
-	a, _ := json.Marshal(result)
-	log.Println(string(a))
 	assert.EqualValues(t, "testing", result.Results[0].Response.Name)
 	assert.EqualValues(t, 123, result.Results[0].Response.ID)
 	assert.EqualValues(t, "jebo87", result.Results[0].Response.Owner)
@@ -293,3 +325,57 @@ func TestCreateReposAllSuccess(t *testing.T) {
 	assert.EqualValues(t, "jebo87", result.Results[1].Response.Owner)
 
 }
+
+func TestCreateReposTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	transport, ctx := useTransport()
+	transport.On(mocks.Match(http.MethodPost, "https://api.github.com/user/repos")).
+		Respond(http.StatusCreated, `{"id": 123,"name": "testing","owner":{"login":"jebo87"}}`)
+
+	ctx, root := otel.Tracer("test").Start(ctx, "request")
+	RepositoryService.CreateRepos(ctx, "", []repositories.CreateRepoRequest{{Name: "one"}, {Name: "two"}})
+	root.End()
+
+	names := make(map[string]int)
+	for _, span := range recorder.Ended() {
+		names[span.Name()]++
+		assert.EqualValues(t, root.SpanContext().TraceID(), span.SpanContext().TraceID())
+	}
+	assert.EqualValues(t, 1, names["RepositoryService.CreateRepos"])
+	assert.EqualValues(t, 2, names["RepositoryService.CreateRepos item"])
+	assert.EqualValues(t, 2, names["RepositoryService.CreateRepo"])
+	assert.EqualValues(t, 2, names["HTTP POST"])
+
+	calls := transport.Calls()
+	assert.EqualValues(t, 2, len(calls))
+	for _, call := range calls {
+		assert.Contains(t, call.Header.Get("traceparent"), root.SpanContext().TraceID().String())
+	}
+}
+
+func TestCreateReposCassette(t *testing.T) {
+	recorder := cassette.New(t, "testdata/cassettes/create_repos.yaml", nil)
+	if recorder.Mode() == cassette.ModeRecord {
+		secrets.GithubToken = secrets.NewEnvProvider("SECRET_GITHUB_ACCESS_TOKEN")
+		defer func() { secrets.GithubToken = secrets.NewStaticProvider("test-token") }()
+	}
+	ctx := restclient.ContextWithClient(context.Background(), recorder)
+
+	result := RepositoryService.CreateRepos(ctx, "", []repositories.CreateRepoRequest{
+		{Name: "golang-cassette-1", Description: "first"},
+		{Name: "golang-cassette-2", Description: "second"},
+	})
+
+	assert.EqualValues(t, http.StatusCreated, result.StatusCode)
+	assert.EqualValues(t, 2, len(result.Results))
+	names := map[string]string{}
+	for _, r := range result.Results {
+		assert.Nil(t, r.Error)
+		names[r.Response.Name] = r.Response.Owner
+	}
+	assert.EqualValues(t, map[string]string{"golang-cassette-1": "jebo87", "golang-cassette-2": "jebo87"}, names)
+}
@@ -0,0 +1,96 @@
+package sessions
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+//CookieName is the cookie holding the id of the session of a user.
+const CookieName = "github_session"
+
+//Session keeps the github token obtained when a user logged in.
+type Session struct {
+	GithubToken string
+	ExpiresAt   time.Time
+}
+
+//Store keeps the sessions on the server side, the users only get their id.
+//Get never returns expired sessions.
+type Store interface {
+	Get(id string) (Session, bool)
+	Set(id string, session Session)
+	Delete(id string)
+}
+
+var (
+	//Default stores the sessions created by the github login.
+	Default Store
+
+	//now is swapped by tests to expire the sessions.
+	now = time.Now
+)
+
+func init() {
+	Default = NewMemoryStore()
+}
+
+//NewID returns a random id, unguessable so it can be used as a session id or
+//an oauth state.
+func NewID() (string, error) {
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(id), nil
+}
+
+//MemoryStore keeps the sessions in memory, they are lost on restart and not
+//shared between instances.
+type MemoryStore struct {
+	mutex    sync.Mutex
+	sessions map[string]Session
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]Session)}
+}
+
+func (s *MemoryStore) Get(id string) (Session, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return Session{}, false
+	}
+	if !now().Before(session.ExpiresAt) {
+		delete(s.sessions, id)
+		return Session{}, false
+	}
+	return session, true
+}
+
+//Set stores session, dropping the expired ones.
+func (s *MemoryStore) Set(id string, session Session) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for other, stored := range s.sessions {
+		if !now().Before(stored.ExpiresAt) {
+			delete(s.sessions, other)
+		}
+	}
+	s.sessions[id] = session
+}
+
+func (s *MemoryStore) Delete(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.sessions, id)
+}
+
+func (s *MemoryStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.sessions)
+}
@@ -0,0 +1,41 @@
+package sessions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreExpiresSessions(t *testing.T) {
+	start := time.Now()
+	now = func() time.Time { return start }
+	defer func() { now = time.Now }()
+	store := NewMemoryStore()
+
+	store.Set("a", Session{GithubToken: "gho_a", ExpiresAt: start.Add(time.Hour)})
+	store.Set("b", Session{GithubToken: "gho_b", ExpiresAt: start.Add(2 * time.Hour)})
+	session, ok := store.Get("a")
+	assert.True(t, ok)
+	assert.EqualValues(t, "gho_a", session.GithubToken)
+
+	now = func() time.Time { return start.Add(time.Hour) }
+	_, ok = store.Get("a")
+	assert.False(t, ok)
+	assert.EqualValues(t, 1, store.Len())
+
+	//expired sessions are dropped when another one is stored
+	now = func() time.Time { return start.Add(3 * time.Hour) }
+	store.Set("c", Session{GithubToken: "gho_c", ExpiresAt: start.Add(4 * time.Hour)})
+	assert.EqualValues(t, 1, store.Len())
+	store.Delete("c")
+	assert.EqualValues(t, 0, store.Len())
+}
+
+func TestNewID(t *testing.T) {
+	first, err := NewID()
+	assert.Nil(t, err)
+	second, _ := NewID()
+	assert.EqualValues(t, 43, len(first))
+	assert.NotEqual(t, first, second)
+}
@@ -0,0 +1,162 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/jebo87/golang-microservices/src/api/log"
+)
+
+var (
+	//reloadCheckInterval is how often the certificate files are checked for changes.
+	reloadCheckInterval = 5 * time.Second
+)
+
+//New builds the tls configuration of the api listener. The certificate, the
+//key and the client CA bundle are read again when the files change, so a
+//rotated certificate is served without a restart.
+func New(cfg config.TLSConfig) (*tls.Config, error) {
+	r := &reloader{
+		certFile: cfg.CertFile,
+		keyFile:  cfg.KeyFile,
+		caFile:   cfg.ClientCAFile,
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	clientAuth := tls.NoClientCert
+	switch cfg.ClientAuth {
+	case config.ClientAuthOptional:
+		clientAuth = tls.VerifyClientCertIfGiven
+	case config.ClientAuthRequire:
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.getCertificate,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return &tls.Config{
+				MinVersion:       tls.VersionTLS12,
+				NextProtos:       []string{"h2", "http/1.1"},
+				GetCertificate:   r.getCertificate,
+				ClientAuth:       clientAuth,
+				ClientCAs:        r.clientCAs(),
+				VerifyConnection: logClientCertificate,
+			}, nil
+		},
+	}, nil
+}
+
+//logClientCertificate writes the identity of every verified client to the log.
+func logClientCertificate(state tls.ConnectionState) error {
+	if len(state.VerifiedChains) > 0 {
+		log.Info("client certificate verified", log.String("client", state.VerifiedChains[0][0].Subject.String()))
+	}
+	return nil
+}
+
+type reloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mutex   sync.Mutex
+	checked time.Time
+	modTime map[string]time.Time
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+}
+
+func (r *reloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.refresh()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.cert, nil
+}
+
+func (r *reloader) clientCAs() *x509.CertPool {
+	r.refresh()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.pool
+}
+
+//refresh loads the files again when one of them changed. A failed reload,
+//usually a rotation caught half way, keeps serving the previous certificate.
+func (r *reloader) refresh() {
+	r.mutex.Lock()
+	if time.Since(r.checked) < reloadCheckInterval {
+		r.mutex.Unlock()
+		return
+	}
+	r.checked = time.Now()
+	changed := false
+	for _, file := range r.files() {
+		if info, err := os.Stat(file); err == nil && !info.ModTime().Equal(r.modTime[file]) {
+			changed = true
+		}
+	}
+	r.mutex.Unlock()
+
+	if !changed {
+		return
+	}
+	if err := r.load(); err != nil {
+		log.Error("error reloading tls certificates, keeping the previous ones", err)
+		return
+	}
+	log.Info("tls certificates reloaded", log.String("cert_file", r.certFile))
+}
+
+func (r *reloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.caFile != "" {
+		files = append(files, r.caFile)
+	}
+	return files
+}
+
+func (r *reloader) load() error {
+	modTime := make(map[string]time.Time)
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %s", file, err)
+		}
+		modTime[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading certificate %s: %s", r.certFile, err)
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		bundle, err := ioutil.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("error reading client CA bundle %s: %s", r.caFile, err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return errors.New("no certificate found in client CA bundle " + r.caFile)
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.cert = &cert
+	r.pool = pool
+	r.modTime = modTime
+	r.checked = time.Now()
+	return nil
+}
@@ -0,0 +1,194 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newCert(t *testing.T, name string, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name, Organization: []string{"golang-microservices"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return &testCert{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+func (c *testCert) keyPEM(t *testing.T) []byte {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	assert.Nil(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (c *testCert) keyPair(t *testing.T) tls.Certificate {
+	pair, err := tls.X509KeyPair(c.pem, c.keyPEM(t))
+	assert.Nil(t, err)
+	return pair
+}
+
+func (c *testCert) write(t *testing.T, dir string, name string, age time.Duration) (string, string) {
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	assert.Nil(t, ioutil.WriteFile(certFile, c.pem, 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, c.keyPEM(t), 0600))
+	when := time.Now().Add(age)
+	assert.Nil(t, os.Chtimes(certFile, when, when))
+	assert.Nil(t, os.Chtimes(keyFile, when, when))
+	return certFile, keyFile
+}
+
+//startServer serves a handler answering with the client subject it saw.
+func startServer(t *testing.T, tlsConfig *tls.Config) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := &http.Server{
+		TLSConfig: tlsConfig,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(r.TLS.VerifiedChains) > 0 {
+				w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+			}
+		}),
+	}
+	go server.ServeTLS(listener, "", "")
+	t.Cleanup(func() { server.Close() })
+	return "https://" + listener.Addr().String()
+}
+
+func client(ca *testCert, certs ...tls.Certificate) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certs},
+	}}
+}
+
+func get(c *http.Client, url string) (string, error) {
+	response, err := c.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	return string(body), err
+}
+
+func setup(t *testing.T) (string, *testCert, config.TLSConfig) {
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	ca := newCert(t, "test-ca", nil, true)
+	certFile, keyFile := newCert(t, "server-1", ca, false).write(t, dir, "server", -time.Minute)
+	caFile := filepath.Join(dir, "ca.crt")
+	assert.Nil(t, ioutil.WriteFile(caFile, ca.pem, 0600))
+
+	return dir, ca, config.TLSConfig{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientCAFile: caFile,
+		ClientAuth:   config.ClientAuthRequire,
+	}
+}
+
+func TestNewInvalidFiles(t *testing.T) {
+	_, err := New(config.TLSConfig{CertFile: "missing.crt", KeyFile: "missing.key"})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "missing.crt")
+}
+
+func TestMutualTLS(t *testing.T) {
+	_, ca, cfg := setup(t)
+	tlsConfig, err := New(cfg)
+	assert.Nil(t, err)
+	url := startServer(t, tlsConfig)
+
+	body, err := get(client(ca, newCert(t, "caller-service", ca, false).keyPair(t)), url)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "caller-service", body)
+
+	_, err = get(client(ca), url)
+	assert.NotNil(t, err)
+
+	stranger := newCert(t, "other-ca", nil, true)
+	_, err = get(client(ca, newCert(t, "stranger", stranger, false).keyPair(t)), url)
+	assert.NotNil(t, err)
+}
+
+func TestOptionalClientCertificate(t *testing.T) {
+	_, ca, cfg := setup(t)
+	cfg.ClientAuth = config.ClientAuthOptional
+	tlsConfig, err := New(cfg)
+	assert.Nil(t, err)
+	url := startServer(t, tlsConfig)
+
+	body, err := get(client(ca), url)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "", body)
+}
+
+func TestCertificateRotation(t *testing.T) {
+	previous := reloadCheckInterval
+	reloadCheckInterval = 0
+	defer func() { reloadCheckInterval = previous }()
+
+	dir, ca, cfg := setup(t)
+	cfg.ClientAuth = config.ClientAuthNone
+	tlsConfig, err := New(cfg)
+	assert.Nil(t, err)
+	url := startServer(t, tlsConfig)
+
+	c := client(ca)
+	response, err := c.Get(url)
+	assert.Nil(t, err)
+	response.Body.Close()
+	assert.EqualValues(t, "server-1", response.TLS.PeerCertificates[0].Subject.CommonName)
+
+	newCert(t, "server-2", ca, false).write(t, dir, "server", 0)
+	c.CloseIdleConnections()
+	response, err = c.Get(url)
+	assert.Nil(t, err)
+	response.Body.Close()
+	assert.EqualValues(t, "server-2", response.TLS.PeerCertificates[0].Subject.CommonName)
+}
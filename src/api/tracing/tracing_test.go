@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jebo87/golang-microservices/src/api/config"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestSetupNone(t *testing.T) {
+	shutdown, err := Setup(context.Background(), config.Default().Tracing)
+	assert.Nil(t, err)
+	assert.Nil(t, shutdown(context.Background()))
+}
+
+func TestSetupFileExporter(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previous)
+
+	dir, err := ioutil.TempDir("", "tracing")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	cfg := config.Default().Tracing
+	cfg.Exporter = config.TracingExporterFile
+	cfg.File = filepath.Join(dir, "traces.json")
+
+	shutdown, err := Setup(context.Background(), cfg)
+	assert.Nil(t, err)
+	_, span := Start(context.Background(), "test-span")
+	span.End()
+	assert.Nil(t, shutdown(context.Background()))
+
+	content, err := ioutil.ReadFile(cfg.File)
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "test-span")
+	assert.Contains(t, string(content), "golang-microservices")
+}
+
+func TestPropagation(t *testing.T) {
+	headers := http.Header{}
+	headers.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx := Extract(context.Background(), propagation.HeaderCarrier(headers))
+	forwarded := http.Header{}
+	Inject(ctx, propagation.HeaderCarrier(forwarded))
+
+	assert.EqualValues(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", forwarded.Get("traceparent"))
+}
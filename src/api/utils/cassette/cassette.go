@@ -0,0 +1,335 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	//EnvMode selects the mode of every cassette, record or replay (the default).
+	EnvMode = "CASSETTE_MODE"
+
+	ModeRecord = "record"
+	ModeReplay = "replay"
+
+	filtered = "[FILTERED]"
+)
+
+var (
+	//ScrubHeaders are written as [FILTERED] in the cassettes.
+	ScrubHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Github-Token"}
+	//ScrubFields are json body fields, at any depth, written as [FILTERED] in the cassettes.
+	ScrubFields = []string{"token", "access_token", "refresh_token", "client_secret", "password"}
+	//ScrubFormFields are fields of form bodies, like the ones of an oauth code
+	//exchange, written as [FILTERED] in the cassettes.
+	ScrubFormFields = []string{"token", "access_token", "refresh_token", "client_secret", "password", "code", "code_verifier"}
+	//ignoredHeaders change on every run and are not written at all.
+	ignoredHeaders = []string{"X-Request-Id", "Traceparent", "Tracestate", "Baggage", "Date"}
+)
+
+//T is the part of *testing.T used by a Recorder.
+type T interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+	Cleanup(func())
+}
+
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+type Interaction struct {
+	Request  Request  `yaml:"request"`
+	Response Response `yaml:"response"`
+}
+
+type Request struct {
+	Method  string      `yaml:"method"`
+	URL     string      `yaml:"url"`
+	Headers http.Header `yaml:"headers,omitempty"`
+	Body    string      `yaml:"body,omitempty"`
+}
+
+type Response struct {
+	Status  int         `yaml:"status"`
+	Headers http.Header `yaml:"headers,omitempty"`
+	Body    string      `yaml:"body,omitempty"`
+}
+
+type cassette struct {
+	Interactions []Interaction `yaml:"interactions"`
+}
+
+//Recorder is an HTTPClient, to be used as restclient.Client or through
+//restclient.ContextWithClient, that writes the calls it sends to a cassette
+//file in record mode and answers them from that file in replay mode.
+type Recorder struct {
+	t      T
+	path   string
+	mode   string
+	client HTTPClient
+
+	mutex        sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+//New returns a Recorder for the cassette at path, in the mode given by
+//CASSETTE_MODE. In record mode the calls are sent with client, or with
+//http.DefaultClient when it is nil, and the cassette is written when the test
+//ends. In replay mode the test fails on every call that is not in the cassette
+//and on calls of the cassette never made.
+func New(t T, path string, client HTTPClient) *Recorder {
+	t.Helper()
+	r := &Recorder{t: t, path: path, mode: os.Getenv(EnvMode), client: client}
+	if r.client == nil {
+		r.client = http.DefaultClient
+	}
+	if r.mode == "" {
+		r.mode = ModeReplay
+	}
+
+	switch r.mode {
+	case ModeRecord:
+		t.Cleanup(func() {
+			if err := r.save(); err != nil {
+				t.Errorf("error writing cassette %s: %s", path, err)
+			}
+		})
+	case ModeReplay:
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("error reading cassette %s, record it with %s=%s: %s", path, EnvMode, ModeRecord, err)
+			return r
+		}
+		var c cassette
+		if err := yaml.UnmarshalStrict(content, &c); err != nil {
+			t.Fatalf("invalid cassette %s: %s", path, err)
+			return r
+		}
+		r.interactions = c.Interactions
+		r.used = make([]bool, len(c.Interactions))
+		t.Cleanup(r.checkAllUsed)
+	default:
+		t.Fatalf("%s must be %s or %s, got %q", EnvMode, ModeRecord, ModeReplay, r.mode)
+	}
+	return r
+}
+
+//Mode returns record or replay.
+func (r *Recorder) Mode() string {
+	return r.mode
+}
+
+//Do implements the HTTPClient interface in clients/restclient/restclient.go
+func (r *Recorder) Do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	recorded := Request{
+		Method:  req.Method,
+		URL:     req.URL.String(),
+		Headers: scrubHeaders(req.Header),
+		Body:    scrubBody(req.Header.Get("Content-Type"), body),
+	}
+
+	if r.mode == ModeRecord {
+		return r.record(req, recorded)
+	}
+	return r.replay(req, recorded)
+}
+
+func (r *Recorder) record(req *http.Request, recorded Request) (*http.Response, error) {
+	response, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.interactions = append(r.interactions, Interaction{
+		Request: recorded,
+		Response: Response{
+			Status:  response.StatusCode,
+			Headers: scrubHeaders(response.Header),
+			Body:    scrubBody(response.Header.Get("Content-Type"), body),
+		},
+	})
+	return response, nil
+}
+
+//replay answers with the first interaction not used yet having the same
+//method, url and json body.
+func (r *Recorder) replay(req *http.Request, recorded Request) (*http.Response, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, interaction := range r.interactions {
+		if r.used[i] || !interaction.Request.matches(recorded) {
+			continue
+		}
+		r.used[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+			StatusCode:    interaction.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        interaction.Response.Headers.Clone(),
+			Body:          ioutil.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	r.t.Errorf("cassette %s has no interaction for %s %s %s", r.path, recorded.Method, recorded.URL, recorded.Body)
+	return nil, fmt.Errorf("no interaction in cassette %s for %s %s", r.path, recorded.Method, recorded.URL)
+}
+
+func (r *Recorder) checkAllUsed() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, used := range r.used {
+		if !used {
+			request := r.interactions[i].Request
+			r.t.Errorf("cassette %s: %s %s was never called", r.path, request.Method, request.URL)
+		}
+	}
+}
+
+func (r *Recorder) save() error {
+	r.mutex.Lock()
+	content, err := yaml.Marshal(cassette{Interactions: r.interactions})
+	r.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.path, content, 0644)
+}
+
+func (r Request) matches(other Request) bool {
+	if r.Method != other.Method || r.URL != other.URL {
+		return false
+	}
+	if r.Body == other.Body {
+		return true
+	}
+	var expected, actual interface{}
+	if json.Unmarshal([]byte(r.Body), &expected) != nil || json.Unmarshal([]byte(other.Body), &actual) != nil {
+		return false
+	}
+	return reflect.DeepEqual(expected, actual)
+}
+
+func scrubHeaders(headers http.Header) http.Header {
+	result := http.Header{}
+	for name, values := range headers {
+		switch {
+		case contains(ignoredHeaders, name):
+		case contains(ScrubHeaders, name):
+			result[name] = []string{filtered}
+		default:
+			result[name] = append([]string(nil), values...)
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+//scrubBody filters the ScrubFields of json bodies and the ScrubFormFields of
+//form bodies, other bodies are kept as they are.
+func scrubBody(contentType string, body []byte) string {
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/x-www-form-urlencoded" {
+		return scrubForm(body)
+	}
+	var document interface{}
+	if len(body) == 0 || json.Unmarshal(body, &document) != nil {
+		return string(body)
+	}
+	if !scrubValue(document) {
+		return string(body)
+	}
+	scrubbed, err := json.Marshal(document)
+	if err != nil {
+		return string(body)
+	}
+	return string(scrubbed)
+}
+
+func scrubForm(body []byte) string {
+	form, err := url.ParseQuery(string(body))
+	if len(body) == 0 || err != nil {
+		return string(body)
+	}
+	changed := false
+	for key := range form {
+		if contains(ScrubFormFields, key) {
+			form[key] = []string{filtered}
+			changed = true
+		}
+	}
+	if !changed {
+		return string(body)
+	}
+	return form.Encode()
+}
+
+//scrubValue returns true when something was filtered.
+func scrubValue(value interface{}) bool {
+	changed := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if contains(ScrubFields, key) {
+				v[key] = filtered
+				changed = true
+			} else if scrubValue(field) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if scrubValue(item) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
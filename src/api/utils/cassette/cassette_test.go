@@ -0,0 +1,175 @@
+package cassette
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeT struct {
+	errors   []string
+	cleanups []func()
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeT) Fatalf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeT) Cleanup(cleanup func()) {
+	f.cleanups = append(f.cleanups, cleanup)
+}
+
+func (f *fakeT) end() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+func withMode(mode string) func() {
+	os.Setenv(EnvMode, mode)
+	return func() { os.Unsetenv(EnvMode) }
+}
+
+func post(t *testing.T, client HTTPClient, url string, body string) *http.Response {
+	request, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	request.Header.Set("Authorization", "token s3cr3t")
+	request.Header.Set("X-Request-ID", "abc")
+	request.Header.Set("Content-Type", "application/json")
+	response, err := client.Do(request)
+	assert.Nil(t, err)
+	return response
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"request":%s,"token":"ghs_123"}`, body)
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "cassettes", "create.yaml")
+
+	restore := withMode(ModeRecord)
+	recording := &fakeT{}
+	recorder := New(recording, path, server.Client())
+	assert.EqualValues(t, ModeRecord, recorder.Mode())
+	response := post(t, recorder, server.URL+"/user/repos", `{"name":"a","password":"p4ss"}`)
+	body, _ := ioutil.ReadAll(response.Body)
+	assert.EqualValues(t, `{"request":{"name":"a","password":"p4ss"},"token":"ghs_123"}`, string(body))
+	recording.end()
+	restore()
+	assert.Empty(t, recording.errors)
+
+	content, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(content), "s3cr3t")
+	assert.NotContains(t, string(content), "p4ss")
+	assert.NotContains(t, string(content), "ghs_123")
+	assert.NotContains(t, string(content), "X-Request-Id")
+	assert.Contains(t, string(content), "[FILTERED]")
+
+	//the server is not called anymore
+	server.Close()
+	replaying := &fakeT{}
+	recorder = New(replaying, path, nil)
+	assert.EqualValues(t, ModeReplay, recorder.Mode())
+	response = post(t, recorder, server.URL+"/user/repos", `{"password":"other", "name":"a"}`)
+	assert.EqualValues(t, http.StatusCreated, response.StatusCode)
+	assert.EqualValues(t, "application/json", response.Header.Get("Content-Type"))
+	body, _ = ioutil.ReadAll(response.Body)
+	assert.EqualValues(t, `{"request":{"name":"a","password":"[FILTERED]"},"token":"[FILTERED]"}`, string(body))
+	replaying.end()
+	assert.Empty(t, replaying.errors)
+}
+
+func TestReplayFailsOnUnmatchedAndUnusedInteractions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.yaml")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`
+interactions:
+- request:
+    method: POST
+    url: https://api.github.com/user/repos
+    body: '{"name":"a"}'
+  response:
+    status: 201
+    body: '{"id":1}'
+`), 0644))
+	replaying := &fakeT{}
+	recorder := New(replaying, path, nil)
+
+	request, _ := http.NewRequest(http.MethodPost, "https://api.github.com/user/repos", strings.NewReader(`{"name":"b"}`))
+	response, err := recorder.Do(request)
+	assert.Nil(t, response)
+	assert.NotNil(t, err)
+	replaying.end()
+
+	assert.EqualValues(t, 2, len(replaying.errors))
+	assert.Contains(t, replaying.errors[0], `has no interaction for POST https://api.github.com/user/repos {"name":"b"}`)
+	assert.Contains(t, replaying.errors[1], "POST https://api.github.com/user/repos was never called")
+}
+
+func TestMissingCassetteAndInvalidMode(t *testing.T) {
+	missing := &fakeT{}
+	New(missing, filepath.Join(t.TempDir(), "missing.yaml"), nil)
+	assert.EqualValues(t, 1, len(missing.errors))
+	assert.Contains(t, missing.errors[0], "record it with CASSETTE_MODE=record")
+
+	defer withMode("rewind")()
+	invalid := &fakeT{}
+	New(invalid, "unused.yaml", nil)
+	assert.EqualValues(t, 1, len(invalid.errors))
+	assert.Contains(t, invalid.errors[0], `CASSETTE_MODE must be record or replay, got "rewind"`)
+}
+
+func TestFormBodiesAreScrubbed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+		fmt.Fprint(w, "access_token=gho_123&scope=repo&token_type=bearer")
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "exchange.yaml")
+	exchange := func(client HTTPClient, secret string) *http.Response {
+		form := "client_id=abc&client_secret=" + secret + "&code=c0d3&code_verifier=v3r1f13r"
+		request, _ := http.NewRequest(http.MethodPost, server.URL+"/login/oauth/access_token", strings.NewReader(form))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response, err := client.Do(request)
+		assert.Nil(t, err)
+		return response
+	}
+
+	restore := withMode(ModeRecord)
+	recording := &fakeT{}
+	exchange(New(recording, path, server.Client()), "s3cr3t")
+	recording.end()
+	restore()
+	assert.Empty(t, recording.errors)
+
+	content, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	for _, secret := range []string{"s3cr3t", "c0d3", "v3r1f13r", "gho_123"} {
+		assert.NotContains(t, string(content), secret)
+	}
+	assert.Contains(t, string(content), "client_id=abc")
+	assert.Contains(t, string(content), "scope=repo")
+
+	replaying := &fakeT{}
+	response := exchange(New(replaying, path, nil), "other")
+	body, _ := ioutil.ReadAll(response.Body)
+	assert.EqualValues(t, "access_token=%5BFILTERED%5D&scope=repo&token_type=bearer", string(body))
+	replaying.end()
+	assert.Empty(t, replaying.errors)
+}
@@ -10,12 +10,14 @@ type ApiError interface {
 	Status() int
 	Message() string
 	Error() string
+	RequestID() string
 }
 
 type apiError struct {
-	EStatus  int    `json:"status"`
-	EMessage string `json:"message"`
-	EError   string `json:"error,omitempty"`
+	EStatus    int    `json:"status"`
+	EMessage   string `json:"message"`
+	EError     string `json:"error,omitempty"`
+	ERequestID string `json:"request_id,omitempty"`
 }
 
 func (e *apiError) Status() int {
@@ -27,6 +29,19 @@ func (e *apiError) Message() string {
 func (e *apiError) Error() string {
 	return e.EError
 }
+func (e *apiError) RequestID() string {
+	return e.ERequestID
+}
+
+//WithRequestID returns a copy of err carrying the id of the request that failed.
+func WithRequestID(err ApiError, requestID string) ApiError {
+	return &apiError{
+		EStatus:    err.Status(),
+		EMessage:   err.Message(),
+		EError:     err.Error(),
+		ERequestID: requestID,
+	}
+}
 
 func NewNotFoundApiError(message string) ApiError {
 	return &apiError{
@@ -49,6 +64,13 @@ func NewBadRequestError(message string) ApiError {
 	}
 }
 
+func NewUnauthorizedError(message string) ApiError {
+	return &apiError{
+		EStatus:  http.StatusUnauthorized,
+		EMessage: message,
+	}
+}
+
 func NewApiError(statusCode int, message string) ApiError {
 	return &apiError{
 		EStatus:  statusCode,
@@ -2,7 +2,10 @@ package mocks
 
 import "net/http"
 
-type MockClient struct{}
+//MockClient answers with Transport when it is set, or with DoFunc otherwise.
+type MockClient struct {
+	Transport *Transport
+}
 
 var (
 	DoFunc func(req *http.Request) (*http.Response, error)
@@ -10,5 +13,8 @@ var (
 
 //Do implements the HTTPClient interface in clients/restclient/restclient.go
 func (m *MockClient) Do(req *http.Request) (*http.Response, error) {
+	if m.Transport != nil {
+		return m.Transport.Do(req)
+	}
 	return DoFunc(req)
 }
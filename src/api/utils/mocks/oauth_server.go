@@ -0,0 +1,116 @@
+package mocks
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+)
+
+type oauthGrant struct {
+	redirectURI string
+	challenge   string
+	token       string
+}
+
+//OAuthServer is a fake github oauth server, so the login flow can be tested
+//offline. Its authorize endpoint approves every login at once, redirecting
+//to redirect_uri with a code, and its token endpoint exchanges each code once
+//for a token after checking the client and the PKCE verifier. The tokens
+//issued are gho_fake_1, gho_fake_2 and so on.
+type OAuthServer struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+
+	mutex  sync.Mutex
+	grants map[string]oauthGrant
+	issued int
+}
+
+func NewOAuthServer(clientID string, clientSecret string) *OAuthServer {
+	s := &OAuthServer{ClientID: clientID, ClientSecret: clientSecret, grants: make(map[string]oauthGrant)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/authorize", s.authorize)
+	mux.HandleFunc("/login/oauth/access_token", s.accessToken)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *OAuthServer) AuthorizeURL() string {
+	return s.URL + "/login/oauth/authorize"
+}
+
+func (s *OAuthServer) TokenURL() string {
+	return s.URL + "/login/oauth/access_token"
+}
+
+func (s *OAuthServer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	switch {
+	case query.Get("client_id") != s.ClientID:
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	case err != nil || !redirect.IsAbs():
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	case query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256":
+		http.Error(w, "a S256 code_challenge is required", http.StatusBadRequest)
+		return
+	}
+
+	s.mutex.Lock()
+	s.issued++
+	code := fmt.Sprintf("code_%d", s.issued)
+	s.grants[code] = oauthGrant{
+		redirectURI: redirect.String(),
+		challenge:   query.Get("code_challenge"),
+		token:       fmt.Sprintf("gho_fake_%d", s.issued),
+	}
+	s.mutex.Unlock()
+
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *OAuthServer) accessToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		http.Error(w, "expected a form POST", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.PostForm.Get("client_id") != s.ClientID || r.PostForm.Get("client_secret") != s.ClientSecret {
+		oauthError(w, "incorrect_client_credentials", "The client_id and/or client_secret passed are incorrect.")
+		return
+	}
+
+	s.mutex.Lock()
+	grant, ok := s.grants[r.PostForm.Get("code")]
+	delete(s.grants, r.PostForm.Get("code"))
+	s.mutex.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok:
+		oauthError(w, "bad_verification_code", "The code passed is incorrect or expired.")
+	case grant.redirectURI != r.PostForm.Get("redirect_uri"):
+		oauthError(w, "redirect_uri_mismatch", "The redirect_uri MUST match the registered callback URL for this application.")
+	case base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge:
+		oauthError(w, "incorrect_code_verifier", "The code_verifier does not match the code_challenge.")
+	default:
+		json.NewEncoder(w).Encode(map[string]string{"access_token": grant.token, "token_type": "bearer", "scope": "repo"})
+	}
+}
+
+//oauthError answers like github, with a 200 describing the error.
+func oauthError(w http.ResponseWriter, code string, description string) {
+	json.NewEncoder(w).Encode(map[string]string{"error": code, "error_description": description})
+}
@@ -0,0 +1,286 @@
+package mocks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//Matcher selects requests by method, url, headers and json body. Empty
+//parts match anything.
+type Matcher struct {
+	method   string
+	url      string
+	headers  http.Header
+	jsonBody interface{}
+	hasBody  bool
+}
+
+//Match returns a matcher for the requests sent with method to url. url is
+//compared with the whole request url, query included.
+func Match(method string, url string) Matcher {
+	return Matcher{method: method, url: url}
+}
+
+//Header only matches requests sending name with value.
+func (m Matcher) Header(name string, value string) Matcher {
+	headers := m.headers.Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+	headers.Add(name, value)
+	m.headers = headers
+	return m
+}
+
+//JSONBody only matches requests whose body is the json encoding of body.
+//Bodies are compared once decoded, so formatting and key order don't matter.
+func (m Matcher) JSONBody(body interface{}) Matcher {
+	m.jsonBody = body
+	m.hasBody = true
+	return m
+}
+
+func (m Matcher) matches(call Call) bool {
+	if m.method != "" && !strings.EqualFold(m.method, call.Method) {
+		return false
+	}
+	if m.url != "" && m.url != call.URL {
+		return false
+	}
+	for name, values := range m.headers {
+		for _, value := range values {
+			if !contains(call.Header.Values(name), value) {
+				return false
+			}
+		}
+	}
+	if m.hasBody {
+		return sameJSON(m.jsonBody, call.Body)
+	}
+	return true
+}
+
+func (m Matcher) String() string {
+	description := strings.TrimSpace(fmt.Sprintf("%s %s", m.method, m.url))
+	if len(m.headers) > 0 {
+		description += fmt.Sprintf(" with headers %v", m.headers)
+	}
+	if m.hasBody {
+		expected, _ := json.Marshal(m.jsonBody)
+		description += fmt.Sprintf(" with body %s", expected)
+	}
+	return description
+}
+
+//Call is a request received by a Transport.
+type Call struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+	err    error
+}
+
+//Stub answers the requests selected by its matcher with its responses, in
+//the order they were added. The last response is repeated once all were used.
+type Stub struct {
+	matcher   Matcher
+	mutex     sync.Mutex
+	responses []response
+	calls     int
+}
+
+//Respond adds a response with status and body.
+func (s *Stub) Respond(status int, body string) *Stub {
+	return s.add(response{status: status, body: []byte(body)})
+}
+
+//RespondJSON adds a response with status and the json encoding of body.
+func (s *Stub) RespondJSON(status int, body interface{}) *Stub {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+	return s.add(response{status: status, header: http.Header{"Content-Type": {"application/json"}}, body: encoded})
+}
+
+//RespondWithHeaders adds a response with status, headers and body.
+func (s *Stub) RespondWithHeaders(status int, header http.Header, body string) *Stub {
+	return s.add(response{status: status, header: header.Clone(), body: []byte(body)})
+}
+
+//RespondError makes the call fail with err, as a connection error would.
+func (s *Stub) RespondError(err error) *Stub {
+	return s.add(response{err: err})
+}
+
+func (s *Stub) add(r response) *Stub {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.responses = append(s.responses, r)
+	return s
+}
+
+func (s *Stub) next() response {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.responses) == 0 {
+		return response{err: fmt.Errorf("no response given for %s", s.matcher)}
+	}
+	i := s.calls
+	if i >= len(s.responses) {
+		i = len(s.responses) - 1
+	}
+	s.calls++
+	return s.responses[i]
+}
+
+//Transport is a fake upstream keeping its own stubs and calls, so tests
+//using different transports can run in parallel. It can be used as the
+//restclient.HTTPClient, as the Transport of an http.Client or through MockClient.
+type Transport struct {
+	mutex sync.Mutex
+	stubs []*Stub
+	calls []Call
+}
+
+func NewTransport() *Transport {
+	return &Transport{}
+}
+
+//On adds a stub for the requests selected by matcher. When several stubs
+//match a request the first one added is used.
+func (t *Transport) On(matcher Matcher) *Stub {
+	stub := &Stub{matcher: matcher}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.stubs = append(t.stubs, stub)
+	return stub
+}
+
+//Do implements the HTTPClient interface in clients/restclient/restclient.go
+func (t *Transport) Do(req *http.Request) (*http.Response, error) {
+	call := Call{Method: req.Method, URL: req.URL.String(), Header: req.Header.Clone()}
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		call.Body = body
+	}
+
+	t.mutex.Lock()
+	t.calls = append(t.calls, call)
+	var stub *Stub
+	for _, s := range t.stubs {
+		if s.matcher.matches(call) {
+			stub = s
+			break
+		}
+	}
+	t.mutex.Unlock()
+
+	if stub == nil {
+		return nil, fmt.Errorf("no mock matches %s %s", call.Method, call.URL)
+	}
+	r := stub.next()
+	if r.err != nil {
+		return nil, r.err
+	}
+	header := r.header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.status, http.StatusText(r.status)),
+		StatusCode:    r.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(r.body)),
+		ContentLength: int64(len(r.body)),
+		Request:       req,
+	}, nil
+}
+
+//RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.Do(req)
+}
+
+//Calls returns every request received, in order.
+func (t *Transport) Calls() []Call {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]Call(nil), t.calls...)
+}
+
+//CallsMatching returns the requests received that are selected by matcher.
+func (t *Transport) CallsMatching(matcher Matcher) []Call {
+	var result []Call
+	for _, call := range t.Calls() {
+		if matcher.matches(call) {
+			result = append(result, call)
+		}
+	}
+	return result
+}
+
+//AssertCalled checks that exactly times requests selected by matcher were received.
+func (t *Transport) AssertCalled(tt assert.TestingT, matcher Matcher, times int) bool {
+	calls := t.CallsMatching(matcher)
+	if len(calls) == times {
+		return true
+	}
+	return assert.Fail(tt, fmt.Sprintf("expected %d calls to %s, got %d", times, matcher, len(calls)), "received:\n%s", t.describeCalls())
+}
+
+//AssertNotCalled checks that no request selected by matcher was received.
+func (t *Transport) AssertNotCalled(tt assert.TestingT, matcher Matcher) bool {
+	return t.AssertCalled(tt, matcher, 0)
+}
+
+func (t *Transport) describeCalls() string {
+	var lines []string
+	for _, call := range t.Calls() {
+		lines = append(lines, fmt.Sprintf("%s %s %s", call.Method, call.URL, call.Body))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sameJSON(expected interface{}, actual []byte) bool {
+	var want, got interface{}
+	encoded, err := json.Marshal(expected)
+	if err != nil || json.Unmarshal(encoded, &want) != nil {
+		return false
+	}
+	if json.Unmarshal(actual, &got) != nil {
+		return false
+	}
+	return reflect.DeepEqual(want, got)
+}
@@ -0,0 +1,120 @@
+package mocks
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingT struct {
+	errors []string
+}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func newRequest(method string, url string, body string, headers ...string) *http.Request {
+	request, _ := http.NewRequest(method, url, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		request.Header.Set(headers[i], headers[i+1])
+	}
+	return request
+}
+
+func TestTransportMatchers(t *testing.T) {
+	transport := NewTransport()
+	url := "https://api.github.com/user/repos"
+	transport.On(Match(http.MethodPost, url).Header("Authorization", "token abc").JSONBody(map[string]interface{}{"name": "a"})).
+		Respond(http.StatusCreated, `{"id":1}`)
+	transport.On(Match(http.MethodPost, url)).Respond(http.StatusUnauthorized, `{}`)
+
+	response, err := transport.Do(newRequest(http.MethodPost, url, `{ "name" : "a" }`, "Authorization", "token abc"))
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusCreated, response.StatusCode)
+	body, _ := ioutil.ReadAll(response.Body)
+	assert.EqualValues(t, `{"id":1}`, string(body))
+
+	response, err = transport.Do(newRequest(http.MethodPost, url, `{"name":"b"}`, "Authorization", "token abc"))
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusUnauthorized, response.StatusCode)
+
+	response, err = transport.Do(newRequest(http.MethodGet, url, ""))
+	assert.Nil(t, response)
+	assert.EqualValues(t, "no mock matches GET https://api.github.com/user/repos", err.Error())
+}
+
+func TestTransportSequence(t *testing.T) {
+	transport := NewTransport()
+	url := "https://api.github.com/repos/a/b"
+	transport.On(Match(http.MethodGet, url)).
+		RespondError(errors.New("connection reset")).
+		RespondWithHeaders(http.StatusServiceUnavailable, http.Header{"Retry-After": {"1"}}, "").
+		RespondJSON(http.StatusOK, map[string]string{"name": "b"})
+
+	_, err := transport.Do(newRequest(http.MethodGet, url, ""))
+	assert.EqualValues(t, "connection reset", err.Error())
+	response, _ := transport.Do(newRequest(http.MethodGet, url, ""))
+	assert.EqualValues(t, http.StatusServiceUnavailable, response.StatusCode)
+	assert.EqualValues(t, "1", response.Header.Get("Retry-After"))
+	for i := 0; i < 2; i++ {
+		//the last response is repeated
+		response, _ = transport.Do(newRequest(http.MethodGet, url, ""))
+		assert.EqualValues(t, http.StatusOK, response.StatusCode)
+		assert.EqualValues(t, "application/json", response.Header.Get("Content-Type"))
+	}
+}
+
+func TestTransportAssertions(t *testing.T) {
+	transport := NewTransport()
+	url := "https://api.github.com/user/repos"
+	transport.On(Match(http.MethodPost, url)).Respond(http.StatusCreated, "")
+
+	transport.Do(newRequest(http.MethodPost, url, `{"name":"a"}`, "Authorization", "token abc"))
+	transport.Do(newRequest(http.MethodPost, url, `{"name":"a"}`))
+	transport.Do(newRequest(http.MethodPost, url, `{"name":"b"}`))
+
+	assert.True(t, transport.AssertCalled(t, Match(http.MethodPost, url), 3))
+	assert.True(t, transport.AssertCalled(t, Match(http.MethodPost, url).JSONBody(map[string]string{"name": "a"}), 2))
+	assert.True(t, transport.AssertCalled(t, Match("", "").Header("Authorization", "token abc"), 1))
+	assert.True(t, transport.AssertNotCalled(t, Match(http.MethodDelete, url)))
+	assert.EqualValues(t, `{"name":"b"}`, string(transport.Calls()[2].Body))
+
+	recorder := &recordingT{}
+	assert.False(t, transport.AssertCalled(recorder, Match(http.MethodPost, url).JSONBody(map[string]string{"name": "c"}), 1))
+	assert.EqualValues(t, 1, len(recorder.errors))
+	assert.Contains(t, recorder.errors[0], `expected 1 calls to POST https://api.github.com/user/repos with body {"name":"c"}, got 0`)
+}
+
+func TestTransportInstancesAreIndependent(t *testing.T) {
+	for i := 0; i < 4; i++ {
+		status := http.StatusOK + i
+		t.Run(fmt.Sprint(status), func(t *testing.T) {
+			t.Parallel()
+			transport := NewTransport()
+			transport.On(Match(http.MethodGet, "https://example.com/")).Respond(status, "")
+			client := &http.Client{Transport: transport}
+
+			for j := 0; j < 20; j++ {
+				response, err := client.Get("https://example.com/")
+				assert.Nil(t, err)
+				assert.EqualValues(t, status, response.StatusCode)
+			}
+			transport.AssertCalled(t, Match(http.MethodGet, "https://example.com/"), 20)
+		})
+	}
+}
+
+func TestMockClientUsesTransport(t *testing.T) {
+	transport := NewTransport()
+	transport.On(Match(http.MethodGet, "https://example.com/")).Respond(http.StatusTeapot, "")
+
+	response, err := (&MockClient{Transport: transport}).Do(newRequest(http.MethodGet, "https://example.com/", ""))
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusTeapot, response.StatusCode)
+}
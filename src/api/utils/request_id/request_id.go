@@ -0,0 +1,52 @@
+package request_id
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+const (
+	Header = "X-Request-ID"
+
+	maxLength = 128
+)
+
+type contextKey struct{}
+
+//New generates a random request id.
+func New() string {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(bytes)
+}
+
+//IsValid tells if an id received from a client can be reused as is. Only
+//short printable ids are accepted so they are safe to log and forward.
+func IsValid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, r := range id {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+//NewContext returns a copy of ctx carrying the request id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+//FromContext returns the request id stored in ctx, or an empty string.
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
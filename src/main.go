@@ -1,7 +1,17 @@
 package main
 
-import "github.com/jebo87/golang-microservices/src/api/app"
+import (
+	"fmt"
+	"os"
+
+	"github.com/jebo87/golang-microservices/src/api/app"
+	"github.com/jebo87/golang-microservices/src/api/config"
+)
 
 func main() {
+	if err := config.Load(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	app.StartApp()
 }